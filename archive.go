@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// 压缩文件的魔数
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// readInput 读取单个输入文件中的弹幕
+// 输入为gzip压缩文件时先解压；为zip压缩包时依次读取其中所有弹幕文件并合并。
+// 无法识别或解析的文件（或压缩包中的条目）会输出错误信息并跳过，只有ctx被取消时才返回错误
+func readInput(ctx context.Context, name string, file inputFile, opts parser.Options) ([]parser.Comment, error) {
+	head := make([]byte, len(zipMagic))
+	n, _ := io.ReadFull(file, head)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+		return nil, nil
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return readGzip(ctx, name, file, opts)
+	case bytes.HasPrefix(head, zipMagic):
+		return readZip(ctx, name, file, opts)
+	default:
+		return readFile(ctx, name, file, opts)
+	}
+}
+
+// readFile 检测格式并解析r中的弹幕
+// r可能是解压出的临时文件或下载到内存中的内容，错误信息中使用用户给出的name
+func readFile(ctx context.Context, name string, r io.Reader, opts parser.Options) ([]parser.Comment, error) {
+	// Detect format
+	format, r, err := parser.ProbeFormatReader(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error detecting format of %s: %v\n", name, err)
+		return nil, nil
+	}
+
+	// Parse comments
+	comments, err := parser.ParseCommentsReader(ctx, r, name, format, opts)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil, nil
+	}
+	return comments, nil
+}
+
+// readGzip 将gzip压缩的弹幕文件解压到临时文件后解析
+func readGzip(ctx context.Context, name string, file inputFile, opts parser.Options) ([]parser.Comment, error) {
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decompressing %s: %v\n", name, err)
+		return nil, nil
+	}
+	defer gz.Close()
+
+	tmp, err := extractTemp(gz)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decompressing %s: %v\n", name, err)
+		return nil, nil
+	}
+	defer removeTemp(tmp)
+
+	return readFile(ctx, name, tmp, opts)
+}
+
+// readZip 依次解析zip压缩包中扩展名为弹幕文件的条目，按mergeComments的规则合并
+// 条目按压缩包中的顺序读取，目录和其他文件会被忽略
+func readZip(ctx context.Context, name string, file inputFile, opts parser.Options) ([]parser.Comment, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+		return nil, nil
+	}
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", name, err)
+		return nil, nil
+	}
+
+	var sources [][]parser.Comment
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !danmakuExts[strings.ToLower(path.Ext(entry.Name))] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entryName := name + ":" + entry.Name
+		comments, err := readZipEntry(ctx, entryName, entry, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(comments) > 0 {
+			sources = append(sources, comments)
+		}
+	}
+	return mergeComments(sources), nil
+}
+
+// readZipEntry 将zip压缩包中的一个条目解压到临时文件后解析
+func readZipEntry(ctx context.Context, name string, entry *zip.File, opts parser.Options) ([]parser.Comment, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", name, err)
+		return nil, nil
+	}
+	defer rc.Close()
+
+	tmp, err := extractTemp(rc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error decompressing %s: %v\n", name, err)
+		return nil, nil
+	}
+	defer removeTemp(tmp)
+
+	// 压缩包中的条目也可能是gzip压缩文件
+	return readInput(ctx, name, tmp, opts)
+}
+
+// trimExt 去掉文件名的扩展名，.xml.gz等gzip压缩文件同时去掉两层扩展名
+func trimExt(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		name = name[:len(name)-len(".gz")]
+	}
+	return name[:len(name)-len(filepath.Ext(name))]
+}
+
+// extractTemp 将r的内容写入临时文件，返回定位在开头的文件
+func extractTemp(r io.Reader) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "danmaku2ass-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		removeTemp(tmp)
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		removeTemp(tmp)
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// removeTemp 关闭并删除临时文件
+func removeTemp(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// writeZip 在临时目录中创建包含给定条目的zip压缩包
+func writeZip(t *testing.T, entries map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "danmaku.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := zip.NewWriter(file)
+	for _, name := range names {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(entries[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadZip(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"ep1.xml":    `<i><d p="2,1,25,16777215,0,0,u,1">第一集</d></i>`,
+		"ep2.xml":    `<i><d p="1,1,25,16777215,0,0,u,1">第二集</d></i>`,
+		"readme.txt": "不是弹幕文件",
+	})
+
+	comments, err := readSource(context.Background(), path, parser.DefaultOptions(25), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("read %d comments, want 2: %+v", len(comments), comments)
+	}
+	// 两个条目的弹幕按时间线合并并重新编号
+	if comments[0].Text != "第二集" || comments[1].Text != "第一集" || comments[0].No != 0 || comments[1].No != 1 {
+		t.Errorf("comments = %+v", comments)
+	}
+}
+
+func TestReadInputErrorName(t *testing.T) {
+	data, err := os.ReadFile("test/bilibili_truncated.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	gzPath := filepath.Join(dir, "truncated.xml.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+	if err := os.WriteFile(gzPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zipPath := writeZip(t, map[string]string{"truncated.xml": string(data)})
+
+	// 解压到临时文件解析时，错误信息仍使用用户给出的文件名
+	for path, name := range map[string]string{gzPath: gzPath, zipPath: zipPath + ":truncated.xml"} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stderr := captureStderr(t, func() {
+			_, err = readInput(context.Background(), path, file, parser.DefaultOptions(25))
+		})
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(stderr, "Error: "+name+": ") || strings.Contains(stderr, "danmaku2ass-") {
+			t.Errorf("stderr = %q, want the error to name %s", stderr, name)
+		}
+	}
+}
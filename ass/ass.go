@@ -3,14 +3,31 @@
 package ass
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/m13253/danmaku2ass/parser"
 )
 
+// checkInterval 生成事件时检查取消的间隔（弹幕条数）
+const checkInterval = 1000
+
+// SortOrder 表示生成事件前弹幕的排序方式
+type SortOrder string
+
+// 支持的排序方式
+const (
+	SortByTimeline  SortOrder = "timeline"  // 按弹幕在视频中出现的时间排序
+	SortByTimestamp SortOrder = "timestamp" // 按弹幕发送时间排序，发送时间缺失的弹幕按出现时间排在最前
+)
+
 // Style 定义ASS字幕样式
 // 包含字体、颜色、大小等样式属性
 type Style struct {
@@ -19,11 +36,13 @@ type Style struct {
 	FontSize     float64 // 字体大小
 	PrimaryColor int     // 主要颜色(0xRRGGBB格式)
 	Alpha        float64 // 透明度(0-1)
+	Alignment    int     // 对齐方式(1-9，数字键盘布局)
 }
 
 // Event 表示ASS对话事件
 // 包含字幕的时间、样式和显示内容等信息
 type Event struct {
+	Layer   int     // 图层，数值大的事件显示在上层
 	Start   float64 // 开始时间(秒)
 	End     float64 // 结束时间(秒)
 	Style   string  // 使用的样式名称
@@ -32,21 +51,66 @@ type Event struct {
 	MarginR int     // 右边距
 	MarginV int     // 垂直边距
 	Effect  string  // 特效名称
+	Meta    string  // 来源弹幕的元信息，非空时在事件前写入一行ASS注释
 }
 
 // Generator 处理ASS字幕的生成
 // 包含所有必要的配置参数和生成方法
 type Generator struct {
-	Width         int     // 视频宽度
-	Height        int     // 视频高度
-	FontName      string  // 字体名称
-	FontSize      float64 // 字体大小
-	Alpha         float64 // 透明度
-	DurationStart float64 // 弹幕持续时间
-	MarginStart   float64 // 边距起始值
+	Width         int       // 视频宽度
+	Height        int       // 视频高度
+	FontName      string    // 字体名称
+	FontSize      float64   // 字体大小
+	Alpha         float64   // 透明度
+	DurationStart float64   // 弹幕持续时间
+	MarginStart   float64   // 边距起始值
+	WrapStyle     int       // 换行方式(0-3)，对应ASS的WrapStyle
+	Collisions    string    // 渲染器碰撞处理方式(Normal/Reverse)
+	Outline       float64   // 描边宽度
+	Shadow        float64   // 阴影距离
+	Blur          float64   // 每个事件的\blur边缘模糊强度，使弹幕在画面复杂时显得柔和，0表示不模糊
+	GlowShadow    float64   // 每个事件的\shad阴影距离，与Blur搭配产生光晕效果，0表示使用样式的Shadow
+	TopAlign      int       // 顶部固定弹幕的对齐方式(1-9)
+	BottomAlign   int       // 底部固定弹幕的对齐方式(1-9)
+	FadeIn        int       // 淡入时长（毫秒）
+	FadeOut       int       // 淡出时长（毫秒）
+	FadeScroll    bool      // 滚动弹幕是否也使用淡入淡出
+	ScrollSpeed   float64   // 滚动速度（像素/秒），0表示滚动弹幕使用固定时长
+	Static        bool      // 将滚动弹幕转为顶部固定弹幕，所有弹幕静止堆叠显示
+	CommentMeta   bool      // 在每个事件前写入记录弹幕序号和发送时间的Comment行
+	SortBy        SortOrder // 弹幕排序方式
+	PixelAspect   float64   // 像素宽高比，非方形像素的视频用于修正显示宽高比
+	RightToLeft   bool      // 以从右到左方向排列阿拉伯文、希伯来文等弹幕
+	MaxDuration   float64   // 弹幕显示时长上限（秒），0表示不限制
+	MinDuration   float64   // 弹幕显示时长下限（秒），保证弹幕来得及阅读，0表示不限制
+	ShuffleRows   bool      // 滚动弹幕随机分布在空闲行中，而不是从上到下依次填充
+	Seed          int64     // ShuffleRows使用的随机数种子，种子相同时输出相同
+	FixedPos      bool      // 固定弹幕使用\pos指定绝对位置，而不是通过MarginV堆叠
+	Invert        bool      // 反转所有颜色（包括描边），用于以浅色为主的视频
+	Contrast      bool      // 将过暗的弹幕颜色替换为白色，保证与黑色描边形成对比
+	Palette       []int     // 调色板(0xRRGGBB格式)，非空时所有弹幕颜色替换为其中最接近的颜色
+	StylePrefix   string    // 生成的样式名前缀，用于与其他字幕共存
+	ScrollAlpha   float64   // 滚动弹幕样式的透明度，负数表示使用Alpha
+	TopAlpha      float64   // 顶部弹幕样式的透明度，负数表示使用Alpha
+	BottomAlpha   float64   // 底部弹幕样式的透明度，负数表示使用Alpha
+	UnknownPos    int       // 位置类型不在0-4范围内的弹幕改用的位置类型，负数表示丢弃
+	FixedLayer    int       // 顶部和底部固定弹幕的图层，滚动弹幕使用图层0
+	EmbedFonts    []string  // 嵌入到[Fonts]节中的字体文件路径
+	Overlap       float64   // 滚动弹幕允许与相邻行重叠的高度比例(0-1)，0表示严格不重叠
+	Vertical      bool      // 包含中日韩文字的固定弹幕改为逐字竖排
+	Title         string    // 写入[Script Info]的Title字段，为空时省略
+	FPS           float64   // 视频帧率，大于0时事件的开始和结束时间对齐到帧边界
+	DimDecay      float64   // 重复弹幕每多出现一次不透明度乘以的系数(0-1)，0表示不降低
+	DimWindow     float64   // 统计重复弹幕的时间窗口（秒）
+	SSA           bool      // 输出旧版SSA v4.00格式而不是ASS v4.00+格式，只使用SSA支持的标签，见ssa.go
+
+	// Rand ShuffleRows使用的随机数生成器，可与调用方的其他随机功能共享，使一个种子决定全部随机结果；
+	// 为nil时每次生成事件都用Seed创建新的生成器
+	Rand *rand.Rand
 }
 
 // NewGenerator 创建一个新的ASS生成器
+// 其余选项使用默认值，可在创建后通过修改字段调整
 // 参数：
 //   - width: 视频宽度
 //   - height: 视频高度
@@ -64,15 +128,29 @@ func NewGenerator(width, height int, fontName string, fontSize, alpha, durationS
 		Alpha:         alpha,
 		DurationStart: durationStart,
 		MarginStart:   marginStart,
+		WrapStyle:     2,
+		Collisions:    "Normal",
+		Outline:       2,
+		Shadow:        0,
+		SortBy:        SortByTimeline,
+		PixelAspect:   1,
+		TopAlign:      8,
+		BottomAlign:   2,
+		ScrollAlpha:   -1,
+		TopAlpha:      -1,
+		BottomAlpha:   -1,
+		UnknownPos:    -1,
+		FixedLayer:    1,
+		DimWindow:     10,
 	}
 }
 
 // GenerateASS 从弹幕评论生成ASS字幕文件
 // 主要步骤：
-// 1. 按时间线对弹幕进行排序
+// 1. 对弹幕进行稳定排序并生成字幕事件
 // 2. 创建输出文件
 // 3. 写入ASS文件头部信息
-// 4. 生成并写入字幕事件
+// 4. 写入字幕事件
 //
 // 参数：
 //   - comments: 解析后的弹幕列表
@@ -81,11 +159,61 @@ func NewGenerator(width, height int, fontName string, fontSize, alpha, durationS
 // 返回值：
 //   - error: 如果生成过程中发生错误则返回错误
 func (g *Generator) GenerateASS(comments []parser.Comment, output string) error {
-	// 按时间线对弹幕进行排序
-	sort.Slice(comments, func(i, j int) bool {
-		return comments[i].Timeline < comments[j].Timeline
+	return g.GenerateASSContext(context.Background(), comments, output)
+}
+
+// GenerateASSContext 与GenerateASS相同，但可以通过ctx取消生成
+// 取消后不会创建输出文件，返回ctx.Err()
+func (g *Generator) GenerateASSContext(ctx context.Context, comments []parser.Comment, output string) error {
+	events, err := g.EventsContext(ctx, comments)
+	if err != nil {
+		return err
+	}
+	return g.WriteASS(events, output)
+}
+
+// Events 将弹幕列表转换为ASS事件列表
+// 弹幕会先按SortBy指定的方式稳定排序，不受支持的弹幕会被跳过
+// 按发送时间排序时事件不再按出现时间排列，固定弹幕的堆叠效果可能不理想
+//
+// 参数：
+//   - comments: 解析后的弹幕列表
+//
+// 返回值：
+//   - []Event: 生成的ASS事件列表
+func (g *Generator) Events(comments []parser.Comment) []Event {
+	events, _ := g.EventsContext(context.Background(), comments)
+	return events
+}
+
+// EventsContext 与Events相同，但可以通过ctx取消
+// 生成过程中定期检查ctx，取消后返回ctx.Err()
+func (g *Generator) EventsContext(ctx context.Context, comments []parser.Comment) ([]Event, error) {
+	// 按时间线对弹幕进行排序，时间相同时按序号排序，序号也相同时保持原有顺序
+	// 保证多次运行的输出完全一致；按发送时间排序时先比较发送时间
+	sort.SliceStable(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		if g.SortBy == SortByTimestamp && a.Timestamp != b.Timestamp {
+			return a.Timestamp < b.Timestamp
+		}
+		if a.Timeline != b.Timeline {
+			return a.Timeline < b.Timeline
+		}
+		return a.No < b.No
 	})
 
+	return g.generateEvents(ctx, comments)
+}
+
+// WriteASS 将ASS事件列表写入ASS字幕文件
+//
+// 参数：
+//   - events: 要写入的事件列表
+//   - output: 输出ASS文件的路径
+//
+// 返回值：
+//   - error: 如果创建或写入文件失败则返回错误
+func (g *Generator) WriteASS(events []Event, output string) error {
 	// 创建输出文件
 	file, err := os.Create(output)
 	if err != nil {
@@ -93,119 +221,511 @@ func (g *Generator) GenerateASS(comments []parser.Comment, output string) error
 	}
 	defer file.Close()
 
-	// 写入ASS文件头部
-	g.writeHeader(file)
-
-	// 生成并写入事件
-	events := g.generateEvents(comments)
-	g.writeEvents(file, events)
+	// 写入ASS文件头部和事件
+	if err := g.writeHeader(file); err != nil {
+		return err
+	}
+	return g.writeEvents(file, events)
+}
 
-	return nil
+// EventsByType 按弹幕类型将事件分为滚动、顶部和底部三组，各组保持原有顺序
+// 分组依据事件的样式：R2L为滚动弹幕，Top为顶部弹幕（包括定位弹幕），Bottom为底部弹幕
+//
+// 参数：
+//   - events: 要分组的事件列表
+//
+// 返回值：
+//   - scroll, top, bottom: 各类型的事件列表
+func (g *Generator) EventsByType(events []Event) (scroll, top, bottom []Event) {
+	for _, e := range events {
+		switch e.Style {
+		case g.StylePrefix + "R2L":
+			scroll = append(scroll, e)
+		case g.StylePrefix + "Top":
+			top = append(top, e)
+		case g.StylePrefix + "Bottom":
+			bottom = append(bottom, e)
+		}
+	}
+	return scroll, top, bottom
 }
 
 // writeHeader 写入ASS文件的头部信息
 // 包括脚本信息和样式定义
 // 主要写入：
-// 1. 脚本基本信息（分辨率、比例等）
+// 1. 脚本基本信息（标题、分辨率、比例等）
 // 2. 样式格式定义
 // 3. 默认样式配置
-func (g *Generator) writeHeader(file *os.File) {
-	// 生成脚本信息部分
-	header := fmt.Sprintf(`[Script Info]
-ScriptType: v4.00+
+// 4. 嵌入的字体（如果有）
+// 开启SSA时写入SSA v4.00的头部，省略SSA不支持的WrapStyle等字段
+func (g *Generator) writeHeader(w io.Writer) error {
+	// 生成脚本信息部分，没有标题时省略Title字段
+	header := "[Script Info]\n"
+	if g.Title != "" {
+		header += "Title: " + g.Title + "\n"
+	}
+	scriptType := "v4.00+"
+	if g.SSA {
+		scriptType = "v4.00"
+	}
+	header += fmt.Sprintf(`Original Script: danmaku2ass
+ScriptType: %s
 PlayResX: %d
 PlayResY: %d
-Aspect Ratio: %f
-Collisions: Normal
-WrapStyle: 2
-ScaledBorderAndShadow: yes
+Aspect Ratio: %s
+Collisions: %s
+`, scriptType, g.Width, g.Height, formatFloat(g.aspectRatio()), g.Collisions)
 
-[V4+ Styles]
-Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
-`, g.Width, g.Height, float64(g.Width)/float64(g.Height))
+	if g.SSA {
+		header += "\n[V4 Styles]\n" + ssaStyleFormat + "\n"
+		for _, style := range g.styles() {
+			header += g.ssaStyleLine(style)
+		}
+	} else {
+		header += fmt.Sprintf("WrapStyle: %d\nScaledBorderAndShadow: yes\n", g.WrapStyle)
+		header += "\n[V4+ Styles]\n" + styleFormat + "\n"
+		for _, style := range g.styles() {
+			header += g.styleLine(style, style.Name)
+		}
+	}
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	if err := g.writeFonts(w); err != nil {
+		return err
+	}
+	format := eventFormat
+	if g.SSA {
+		format = ssaEventFormat
+	}
+	_, err := io.WriteString(w, "\n[Events]\n"+format+"\n")
+	return err
+}
 
-	// Write default styles
-	styles := []Style{
-		{Name: "R2L", FontName: g.FontName, FontSize: g.FontSize},
-		{Name: "Top", FontName: g.FontName, FontSize: g.FontSize},
-		{Name: "Bottom", FontName: g.FontName, FontSize: g.FontSize},
+// styles 返回生成器使用的默认样式，样式名带有StylePrefix前缀
+// 滚动弹幕以左上角为锚点(7)，固定弹幕分别以顶部居中(8)和底部居中(2)为锚点
+func (g *Generator) styles() []Style {
+	return []Style{
+		{Name: g.StylePrefix + "R2L", FontName: g.FontName, FontSize: g.FontSize, PrimaryColor: g.color(0xFFFFFF), Alpha: g.styleAlpha(g.ScrollAlpha), Alignment: 7},
+		{Name: g.StylePrefix + "Top", FontName: g.FontName, FontSize: g.FontSize, PrimaryColor: g.color(0xFFFFFF), Alpha: g.styleAlpha(g.TopAlpha), Alignment: g.TopAlign},
+		{Name: g.StylePrefix + "Bottom", FontName: g.FontName, FontSize: g.FontSize, PrimaryColor: g.color(0xFFFFFF), Alpha: g.styleAlpha(g.BottomAlpha), Alignment: g.BottomAlign},
 	}
+}
 
-	for _, style := range styles {
-		header += fmt.Sprintf("Style: %s,%s,%f,&H%X,&H%X,&H000000,&H000000,0,0,0,0,100,100,0,0,1,2,0,2,20,20,2,0\n",
-			style.Name, style.FontName, style.FontSize,
-			int(g.Alpha*255)<<24, int(g.Alpha*255)<<24)
+// styleAlpha 返回样式的透明度，alpha为负数时使用全局的Alpha
+func (g *Generator) styleAlpha(alpha float64) float64 {
+	if alpha < 0 {
+		return g.Alpha
 	}
+	return alpha
+}
 
-	header += "\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"
-	file.WriteString(header)
+// styleLine 生成样式定义行，name为写入文件的样式名
+func (g *Generator) styleLine(style Style, name string) string {
+	alpha := int(style.Alpha * 255)
+	// 描边默认为黑色，反转颜色时改为白色
+	outline := convertColor(0x000000)
+	if g.Invert {
+		outline = convertColor(0xFFFFFF)
+	}
+	return fmt.Sprintf("Style: %s,%s,%s,&H%02X%s,&H%02X%s,&H%s,&H000000,0,0,0,0,100,100,0,0,1,%s,%s,%d,20,20,2,0\n",
+		name, style.FontName, formatFloat(style.FontSize),
+		alpha, convertColor(style.PrimaryColor), alpha, convertColor(style.PrimaryColor), outline,
+		formatFloat(g.Outline), formatFloat(g.Shadow), style.Alignment)
+}
+
+// aspectRatio 计算视频的显示宽高比
+// 显示宽高比 = 宽 / 高 × 像素宽高比，PixelAspect非正数时按方形像素处理；
+// 高度非正数时返回0，避免除零
+//
+// 事件中的坐标（包括\move的x坐标）始终以PlayResX像素为单位，
+// 由渲染器按显示宽高比横向拉伸，因此无需额外缩放
+func (g *Generator) aspectRatio() float64 {
+	if g.Height <= 0 {
+		return 0
+	}
+	par := g.PixelAspect
+	if par <= 0 {
+		par = 1
+	}
+	return float64(g.Width) / float64(g.Height) * par
 }
 
 // generateEvents 从弹幕列表生成ASS事件列表
-// 将每条弹幕转换为对应的ASS字幕事件
+// 将每条弹幕转换为对应的ASS字幕事件，每处理checkInterval条弹幕检查一次ctx
 //
 // 参数：
+//   - ctx: 用于取消生成的上下文
 //   - comments: 解析后的弹幕列表
 //
 // 返回值：
 //   - []Event: 生成的ASS事件列表
-func (g *Generator) generateEvents(comments []parser.Comment) []Event {
+//   - error: 被取消时返回ctx.Err()
+func (g *Generator) generateEvents(ctx context.Context, comments []parser.Comment) ([]Event, error) {
 	events := make([]Event, 0, len(comments))
+	rows := g.newLayout()
+	dup := g.newDuplicates()
+
+	for i, comment := range comments {
+		if i%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		if event, ok := g.nextEvent(comment, rows, dup); ok {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// newDuplicates 返回生成一个文件的事件时使用的重复计数器，没有开启重复弹幕变淡时返回nil
+func (g *Generator) newDuplicates() *duplicateCounter {
+	if g.DimDecay <= 0 {
+		return nil
+	}
+	return newDuplicateCounter(g.DimWindow)
+}
+
+// nextEvent 将按顺序处理的下一条弹幕转换为事件，GenerateASS和StreamASS共用
+// 重复的弹幕保留但逐渐变淡，使刷屏内容退到背景中（dup为nil时不处理）；设置了FPS时对齐到帧边界
+func (g *Generator) nextEvent(comment parser.Comment, rows *rowAllocator, dup *duplicateCounter) (Event, bool) {
+	if dup != nil {
+		if rank := dup.rank(comment); rank > 0 {
+			comment.Alpha = g.dimmedAlpha(comment, rank)
+		}
+	}
+
+	event, ok := g.event(comment, rows)
+	if ok && g.FPS > 0 {
+		event.Start, event.End = g.snapToFrames(event.Start, event.End)
+	}
+	return event, ok
+}
+
+// snapToFrames 将事件的开始和结束时间对齐到最近的帧边界（1/FPS的整数倍）
+// 对齐后至少保留一帧的显示时间
+func (g *Generator) snapToFrames(start, end float64) (float64, float64) {
+	startFrame := math.Round(start * g.FPS)
+	endFrame := math.Round(end * g.FPS)
+	if endFrame <= startFrame {
+		endFrame = startFrame + 1
+	}
+	return startFrame / g.FPS, endFrame / g.FPS
+}
+
+// newLayout 创建生成一个文件的事件时使用的行分配器
+func (g *Generator) newLayout() *rowAllocator {
+	rows := newRowAllocator(g.Width, g.Height)
+	if g.ShuffleRows {
+		rows.rng = g.Rand
+		if rows.rng == nil {
+			rows.rng = rand.New(rand.NewSource(g.Seed))
+		}
+	}
+	rows.overlap = g.Overlap
+	return rows
+}
+
+// event 将单条弹幕转换为ASS事件，并在rows中占用显示行
+// 弹幕位置类型不受支持时返回false
+func (g *Generator) event(comment parser.Comment, rows *rowAllocator) (Event, bool) {
+	// 未知的位置类型按UnknownPos处理
+	if !parser.KnownPosition(comment.Position) {
+		if g.UnknownPos < 0 {
+			return Event{}, false
+		}
+		comment.Position = g.UnknownPos
+	}
+
+	// 静止模式下滚动弹幕改为顶部固定弹幕
+	if g.Static && (comment.Position == 0 || comment.Position == 3) {
+		comment.Position = 1
+	}
+
+	// 转换时间线为ASS时间格式
+	start := comment.Timeline
+	end := start + g.duration(comment)
 
-	for _, comment := range comments {
-		// 转换时间线为ASS时间格式
-		start := comment.Timeline
-		end := start + g.DurationStart
-
-		// 根据弹幕位置确定样式
-		var style string
-		switch comment.Position {
-		case 0: // 从右到左滚动
-			style = "R2L"
-		case 1: // 顶部固定
-			style = "Top"
-		case 2: // 底部固定
-			style = "Bottom"
+	// 根据弹幕位置确定样式
+	var style string
+	switch comment.Position {
+	case 0, 3: // 从右到左、从左到右滚动，共用滚动弹幕的样式
+		style = "R2L"
+	case 1: // 顶部固定
+		style = "Top"
+	case 2: // 底部固定
+		style = "Bottom"
+	case 4: // 定位弹幕，使用顶部样式并通过\pos指定位置
+		style = "Top"
+	default:
+		return Event{}, false
+	}
+	style = g.StylePrefix + style
+
+	// 竖排模式下固定的中日韩弹幕每个字单独成行，按竖排后的尺寸分配位置
+	if g.Vertical && (comment.Position == 1 || comment.Position == 2) && hasCJK(comment.Text) {
+		var lines int
+		comment.Text, lines = verticalText(comment.Text)
+		comment.Height = float64(lines) * comment.Size
+		comment.Width = comment.Size
+	}
+
+	// 固定弹幕通过垂直边距（或\pos）堆叠，滚动弹幕通过\move的纵坐标错开，避免互相遮挡；
+	// SSA没有\move和\pos，改用Banner效果滚动，并且只通过边距定位
+	marginL, marginV := 0, 0
+	var move, effect string
+	if comment.Position == 4 {
+		// 定位弹幕自带坐标，不占用显示行
+		if g.SSA {
+			move = `\a5`
+			marginL, marginV = g.ssaAbsoluteMargins(comment)
+		} else {
+			move = g.absolutePos(comment)
+		}
+	} else {
+		row := rows.allocate(comment.Position, &slot{start: start, end: end, width: comment.Width}, comment.Height)
+		switch {
+		case (comment.Position == 0 || comment.Position == 3) && g.SSA:
+			effect = g.ssaBanner(comment, end-start)
+			marginV = row
+		case comment.Position == 0 || comment.Position == 3:
+			move = g.scrollMove(comment, row)
+		case g.FixedPos && !g.SSA:
+			move = g.fixedPos(comment, row)
 		default:
-			continue
+			marginV = row
 		}
+	}
 
-		// 创建事件
-		events = append(events, Event{
-			Start:   start,
-			End:     end,
-			Style:   style,
-			Text:    comment.Text,
-			MarginL: 0,
-			MarginR: 0,
-			MarginV: 0,
-		})
+	// 记录来源弹幕的元信息，便于追溯
+	var meta string
+	if g.CommentMeta {
+		meta = fmt.Sprintf("no=%d timestamp=%d", comment.No, comment.Timestamp)
 	}
 
-	return events
+	// 从右到左书写的弹幕使用双向控制字符指定基础方向
+	text := comment.Text
+	if g.RightToLeft && isRightToLeft(text) {
+		text = embedRightToLeft(text)
+	}
+
+	// 事件行中不能出现真正的换行，使用ASS的强制换行符
+	text = strings.ReplaceAll(text, "\n", `\N`)
+
+	// 固定弹幕位于滚动弹幕之上的图层，保证不被滚动弹幕遮挡
+	layer := 0
+	if comment.Position == 1 || comment.Position == 2 || comment.Position == 4 {
+		layer = g.FixedLayer
+	}
+
+	return Event{
+		Layer:   layer,
+		Start:   start,
+		End:     end,
+		Style:   style,
+		Text:    g.overrideTags(comment, move) + text,
+		MarginL: marginL,
+		MarginR: 0,
+		MarginV: marginV,
+		Effect:  effect,
+		Meta:    meta,
+	}, true
+}
+
+// scrollMove 生成滚动弹幕的\move标签
+// 文本左端从屏幕右边缘移动到文本右端离开屏幕左边缘（从左到右滚动的弹幕方向相反），
+// 省略\move的时间参数，使动画恰好覆盖整个事件：End由duration决定，动画在End时刻结束
+func (g *Generator) scrollMove(comment parser.Comment, row int) string {
+	if comment.Position == 3 {
+		return fmt.Sprintf(`\move(%s,%d,%d,%d)`, formatFloat(-comment.Width), row, g.Width, row)
+	}
+	return fmt.Sprintf(`\move(%d,%d,%s,%d)`, g.Width, row, formatFloat(-comment.Width), row)
+}
+
+// absolutePos 生成定位弹幕的\pos标签
+// 弹幕的X、Y为左上角相对于屏幕的比例，使用\an7使\pos的锚点为左上角
+func (g *Generator) absolutePos(comment parser.Comment) string {
+	return fmt.Sprintf(`\an7\pos(%s,%s)`, formatFloat(comment.X*float64(g.Width)), formatFloat(comment.Y*float64(g.Height)))
+}
+
+// fixedPos 生成固定弹幕的\pos标签
+// row为分配到的起始行，顶部弹幕从屏幕顶端算起，底部弹幕从屏幕底端算起；
+// \pos的坐标是样式对齐方式的锚点，因此按对齐方式换算出锚点的横纵坐标
+func (g *Generator) fixedPos(comment parser.Comment, row int) string {
+	align := g.TopAlign
+	top := float64(row)
+	if comment.Position == 2 {
+		align = g.BottomAlign
+		top = float64(g.Height-row) - comment.Height
+	}
+
+	// 横坐标：1/4/7靠左，2/5/8居中，3/6/9靠右
+	var x float64
+	switch (align - 1) % 3 {
+	case 1:
+		x = float64(g.Width) / 2
+	case 2:
+		x = float64(g.Width)
+	}
+
+	// 纵坐标：7/8/9为上边缘，4/5/6为中线，1/2/3为下边缘
+	y := top
+	switch {
+	case align <= 3:
+		y = top + comment.Height
+	case align <= 6:
+		y = top + comment.Height/2
+	}
+
+	return fmt.Sprintf(`\pos(%s,%s)`, formatFloat(x), formatFloat(y))
+}
+
+// duration 计算弹幕的显示时长（秒）
+// 设置了滚动速度时，滚动弹幕的时长为移动距离（屏幕宽度加文本宽度）除以滚动速度，
+// 使长短弹幕的视觉速度一致；其余情况使用固定时长；弹幕自带时长时优先使用弹幕的时长。
+// 时长不超过MaxDuration，被截断的滚动弹幕的\move仍覆盖整个事件，因此滚动得更快；
+// 同理时长不足MinDuration的弹幕被延长，滚动弹幕因此滚动得更慢
+func (g *Generator) duration(comment parser.Comment) float64 {
+	d := g.DurationStart
+	scrolling := comment.Position == 0 || comment.Position == 3
+	if comment.Duration > 0 {
+		d = comment.Duration
+	} else if scrolling && g.ScrollSpeed > 0 {
+		d = (float64(g.Width) + comment.Width) / g.ScrollSpeed
+	}
+	if g.MaxDuration > 0 && d > g.MaxDuration {
+		d = g.MaxDuration
+	}
+	if d < g.MinDuration {
+		d = g.MinDuration
+	}
+	return d
+}
+
+// overrideTags 生成单条弹幕的ASS覆盖标签
+// 仅输出与样式默认值不同的属性，没有需要覆盖的属性时返回空字符串
+//
+// 参数：
+//   - comment: 要生成覆盖标签的弹幕
+//   - motion: 位置或移动标签（如\move），放在其他标签之前，可为空
+//
+// 返回值：
+//   - string: 形如{\fn字体}的覆盖标签
+func (g *Generator) overrideTags(comment parser.Comment, motion string) string {
+	tags := motion
+
+	// 字体覆盖
+	if comment.FontName != "" && comment.FontName != g.FontName {
+		tags += `\fn` + comment.FontName
+	}
+
+	// 颜色覆盖，白色为样式默认颜色
+	if color := g.color(comment.Color); color != g.color(0xFFFFFF) {
+		tags += `\c&H` + convertColor(color) + `&`
+	}
+
+	// 描边颜色覆盖，与文字颜色一样随Invert反转
+	if comment.OutlineColor != 0 {
+		outline := comment.OutlineColor
+		if g.Invert {
+			outline ^= 0xFFFFFF
+		}
+		tags += `\3c&H` + convertColor(outline) + `&`
+	}
+
+	// 透明度覆盖，ASS的\alpha为透明度，与不透明度相反；SSA只有样式级的AlphaLevel
+	if comment.Alpha > 0 && !g.SSA {
+		tags += fmt.Sprintf(`\alpha&H%02X&`, 255-comment.Alpha)
+	}
+
+	// 字号覆盖，与样式字号相差不足1时忽略
+	if math.Abs(comment.Size-g.FontSize) >= 1 {
+		tags += `\fs` + formatFloat(comment.Size)
+	}
+
+	// 淡入淡出效果，默认只作用于固定弹幕；SSA没有\fad
+	if (g.FadeIn > 0 || g.FadeOut > 0) && !g.SSA {
+		fixed := comment.Position == 1 || comment.Position == 2 || comment.Position == 4
+		if fixed || g.FadeScroll {
+			tags += fmt.Sprintf(`\fad(%d,%d)`, g.FadeIn, g.FadeOut)
+		}
+	}
+
+	// 光晕效果：模糊边缘和阴影，SSA没有这两个标签
+	if g.Blur > 0 && !g.SSA {
+		tags += `\blur` + formatFloat(g.Blur)
+	}
+	if g.GlowShadow > 0 && !g.SSA {
+		tags += `\shad` + formatFloat(g.GlowShadow)
+	}
+
+	// 粗体和斜体覆盖，只有中间表示(IR)输入和库的调用方会设置
+	if comment.Bold {
+		tags += `\b1`
+	}
+	if comment.Italic {
+		tags += `\i1`
+	}
+
+	if tags == "" {
+		return ""
+	}
+	return "{" + tags + "}"
 }
 
 // writeEvents 将ASS事件列表写入文件
 // 将每个事件转换为ASS对话行格式并写入
 //
 // 参数：
-//   - file: 要写入的文件
+//   - w: 写入目标
 //   - events: 要写入的事件列表
-func (g *Generator) writeEvents(file *os.File, events []Event) {
+func (g *Generator) writeEvents(w io.Writer, events []Event) error {
 	for _, event := range events {
-		// 将时间转换为ASS格式 (H:MM:SS.cc)
-		start := formatTime(event.Start)
-		end := formatTime(event.End)
+		if _, err := io.WriteString(w, g.formatEvent(event)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// 写入事件行
-		line := fmt.Sprintf("Dialogue: 0,%s,%s,%s,,0,0,0,,%s\n",
-			start, end, event.Style, event.Text)
-		file.WriteString(line)
+// formatEvent 按输出格式将单个事件转换为以换行结尾的对话行
+func (g *Generator) formatEvent(event Event) string {
+	if g.SSA {
+		return ssaEventLine(event)
 	}
+	return eventLine(event)
 }
 
+// eventLine 将单个事件转换为以换行结尾的ASS对话行
+// 事件带有元信息时先输出一行Comment，渲染器会忽略Comment行
+func eventLine(event Event) string {
+	// 将时间转换为ASS格式 (H:MM:SS.cc)
+	start := formatTime(event.Start)
+	end := formatTime(event.End)
+
+	var line string
+	if event.Meta != "" {
+		line = fmt.Sprintf("Comment: %d,%s,%s,%s,,0,0,0,,%s\n",
+			event.Layer, start, end, event.Style, event.Meta)
+	}
+
+	line += fmt.Sprintf("Dialogue: %d,%s,%s,%s,,%d,%d,%d,%s,%s\n",
+		event.Layer, start, end, event.Style, event.MarginL, event.MarginR, event.MarginV, event.Effect, event.Text)
+	return line
+}
+
+// SingleDigitHours 时间戳的小时数只有一位时能表示的时长（秒）
+// ASS习惯上小时数只写一位，部分渲染器不支持或会截断更长的时间，结束时间达到该值的事件可能无法正常显示
+const SingleDigitHours = 10 * 3600
+
 // formatTime 将秒数转换为ASS时间格式 (H:MM:SS.cc)
 // 例如：123.45秒会被转换为0:02:03.45
+// 不足1厘秒的部分舍去；先换算为厘秒再拆分，并容忍浮点误差，避免0.4这样的值因误差被写成0.39
+// 小时数不限位数，超过9小时时照常写成多位数（如40:00:00.00），见SingleDigitHours
 //
 // 参数：
 //   - seconds: 要转换的秒数
@@ -213,10 +733,74 @@ func (g *Generator) writeEvents(file *os.File, events []Event) {
 // 返回值：
 //   - string: ASS格式的时间字符串
 func formatTime(seconds float64) string {
-	hours := int(seconds) / 3600
-	minutes := (int(seconds) % 3600) / 60
-	secs := int(seconds) % 60
-	centisecs := int(math.Floor((seconds - math.Floor(seconds)) * 100))
+	total := int64(math.Floor(seconds*100 + 1e-6))
+	hours := total / 360000
+	minutes := total / 6000 % 60
+	secs := total / 100 % 60
+	centisecs := total % 100
 
 	return fmt.Sprintf("%d:%02d:%02d.%02d", hours, minutes, secs, centisecs)
 }
+
+// color 按Invert、Contrast和Palette选项调整0xRRGGBB格式的颜色
+// 反转时与0xFFFFFF异或；对比模式下相对亮度低于0.2的颜色替换为白色；
+// 设置了调色板时，最后再替换为调色板中最接近的颜色
+func (g *Generator) color(rgb int) int {
+	if g.Invert {
+		rgb ^= 0xFFFFFF
+	} else if g.Contrast && luminance(rgb) < 0.2 {
+		rgb = 0xFFFFFF
+	}
+	if len(g.Palette) > 0 {
+		rgb = nearestColor(rgb, g.Palette)
+	}
+	return rgb
+}
+
+// nearestColor 返回调色板中与rgb在RGB空间中欧氏距离最近的颜色，距离相同时取靠前的颜色
+func nearestColor(rgb int, palette []int) int {
+	best, bestDist := palette[0], -1
+	for _, p := range palette {
+		dr := (rgb>>16)&0xFF - (p>>16)&0xFF
+		dg := (rgb>>8)&0xFF - (p>>8)&0xFF
+		db := rgb&0xFF - p&0xFF
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = p, d
+		}
+	}
+	return best
+}
+
+// luminance 计算0xRRGGBB格式颜色的相对亮度(0-1)，按ITU-R BT.709加权
+func luminance(rgb int) float64 {
+	r := float64((rgb>>16)&0xFF) / 255
+	g := float64((rgb>>8)&0xFF) / 255
+	b := float64(rgb&0xFF) / 255
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+// convertColor 将0xRRGGBB格式的颜色转换为ASS使用的BBGGRR十六进制字符串
+//
+// 参数：
+//   - rgb: 0xRRGGBB格式的颜色值
+//
+// 返回值：
+//   - string: BBGGRR格式的十六进制字符串
+func convertColor(rgb int) string {
+	r := (rgb >> 16) & 0xFF
+	g := (rgb >> 8) & 0xFF
+	b := rgb & 0xFF
+	return fmt.Sprintf("%02X%02X%02X", b, g, r)
+}
+
+// formatFloat 将浮点数格式化为ASS文件中使用的数值字符串
+// 保留至多3位小数并去掉末尾的0，例如48.0输出为48，1.7777输出为1.778
+//
+// 参数：
+//   - v: 要格式化的数值
+//
+// 返回值：
+//   - string: 格式化后的字符串
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
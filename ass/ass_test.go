@@ -0,0 +1,690 @@
+package ass
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// header 返回生成器写出的文件头
+func header(t *testing.T, g *Generator) string {
+	t.Helper()
+	var b strings.Builder
+	if err := g.writeHeader(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestHeaderWrapStyleCollisions(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.WrapStyle = 0
+	g.Collisions = "Reverse"
+
+	h := header(t, g)
+	for _, line := range []string{"WrapStyle: 0\n", "Collisions: Reverse\n"} {
+		if !strings.Contains(h, line) {
+			t.Errorf("header does not contain %q:\n%s", line, h)
+		}
+	}
+}
+
+func TestHeaderTitle(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	if h := header(t, g); strings.Contains(h, "Title:") || !strings.Contains(h, "Original Script: danmaku2ass\n") {
+		t.Errorf("header without title:\n%s", h)
+	}
+
+	g.Title = "第1话"
+	if h := header(t, g); !strings.HasPrefix(h, "[Script Info]\nTitle: 第1话\n") {
+		t.Errorf("header does not start with the title:\n%s", h)
+	}
+}
+
+// styleColumns 按styleFormat的字段名拆分样式行
+func styleColumns(t *testing.T, line string) map[string]string {
+	t.Helper()
+	names := strings.Split(strings.TrimPrefix(styleFormat, "Format: "), ", ")
+	values := strings.Split(strings.TrimSuffix(strings.TrimPrefix(line, "Style: "), "\n"), ",")
+	if len(values) != len(names) {
+		t.Fatalf("style line has %d columns, want %d: %s", len(values), len(names), line)
+	}
+	columns := make(map[string]string)
+	for i, name := range names {
+		columns[name] = values[i]
+	}
+	return columns
+}
+
+func TestStyleLineOutlineShadow(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.Outline = 1.5
+	g.Shadow = 3
+
+	columns := styleColumns(t, g.styleLine(g.styles()[0], "R2L"))
+	if columns["Outline"] != "1.5" || columns["Shadow"] != "3" {
+		t.Errorf("Outline, Shadow = %s, %s, want 1.5, 3", columns["Outline"], columns["Shadow"])
+	}
+}
+
+func TestStyleAlignment(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.TopAlign = 7
+	g.BottomAlign = 3
+
+	want := map[string]string{"R2L": "7", "Top": "7", "Bottom": "3"}
+	for _, style := range g.styles() {
+		columns := styleColumns(t, g.styleLine(style, style.Name))
+		if columns["Alignment"] != want[style.Name] {
+			t.Errorf("%s Alignment = %s, want %s", style.Name, columns["Alignment"], want[style.Name])
+		}
+	}
+}
+
+func TestOverrideTagsFont(t *testing.T) {
+	g := NewGenerator(1920, 1080, "MS PGothic", 48, 0.8, 5, 5)
+
+	c := parser.Comment{Text: "明朝", Size: 48, Color: 0xFFFFFF, FontName: "MS PMincho"}
+	if tags := g.overrideTags(c, ""); tags != `{\fnMS PMincho}` {
+		t.Errorf("tags = %s, want {\\fnMS PMincho}", tags)
+	}
+
+	// 与默认字体相同时不输出
+	c.FontName = "MS PGothic"
+	if tags := g.overrideTags(c, ""); tags != "" {
+		t.Errorf("tags = %s, want none", tags)
+	}
+}
+
+func TestOverrideTagsBoldItalic(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+
+	c := parser.Comment{Text: "粗体", Size: 48, Color: 0xFFFFFF, Bold: true}
+	if tags := g.overrideTags(c, ""); tags != `{\b1}` {
+		t.Errorf("bold tags = %s, want {\\b1}", tags)
+	}
+	c.Italic = true
+	if tags := g.overrideTags(c, ""); tags != `{\b1\i1}` {
+		t.Errorf("bold italic tags = %s, want {\\b1\\i1}", tags)
+	}
+}
+
+func TestStyleLineFontSize(t *testing.T) {
+	// 按分辨率缩放后的字号带有很长的小数
+	g := NewGenerator(1280, 720, "Sans", 48*1280.0/1920, 0.8, 5, 5)
+
+	line := g.styleLine(g.styles()[0], "R2L")
+	if strings.Contains(line, "32.000000") || strings.Contains(line, "33333") {
+		t.Errorf("style line has an unformatted float: %s", line)
+	}
+	if size := styleColumns(t, line)["Fontsize"]; size != "32" {
+		t.Errorf("Fontsize = %s, want 32", size)
+	}
+
+	g.FontSize = 100.0 / 3
+	if size := styleColumns(t, g.styleLine(g.styles()[0], "R2L"))["Fontsize"]; size != "33.333" {
+		t.Errorf("Fontsize = %s, want 33.333", size)
+	}
+}
+
+func TestFadeFixedComments(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.FadeIn = 200
+	g.FadeOut = 500
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, Text: "滚动", Position: 0, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, Text: "顶部", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, Text: "底部", Position: 2, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	})
+	for _, e := range events {
+		fixed := e.Style != "R2L"
+		if got := strings.Contains(e.Text, `\fad(200,500)`); got != fixed {
+			t.Errorf("%s event has \\fad = %v, want %v: %s", e.Style, got, fixed, e.Text)
+		}
+	}
+}
+
+func TestScrollSpeedDuration(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.ScrollSpeed = 240
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, Text: "短", Size: 48, Width: 48, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 2, Text: "很长很长很长很长很长的弹幕", Size: 48, Width: 624, Height: 48, Color: 0xFFFFFF},
+	})
+	short, long := events[0].End-events[0].Start, events[1].End-events[1].Start
+	if long <= short {
+		t.Errorf("long comment lasts %v, short comment %v", long, short)
+	}
+	if want := (1920.0 + 48) / 240; short != want {
+		t.Errorf("short comment lasts %v, want %v", short, want)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.Static = true
+
+	var comments []parser.Comment
+	for i := 0; i < 3; i++ {
+		comments = append(comments, parser.Comment{Timeline: 1, No: i, Text: "弹幕", Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+	}
+	events := g.Events(comments)
+	for i, e := range events {
+		if strings.Contains(e.Text, `\move`) {
+			t.Errorf("event %d has \\move: %s", i, e.Text)
+		}
+		if e.Style != "Top" || e.MarginV != 48*i {
+			t.Errorf("event %d: style %s, MarginV %d, want Top, %d", i, e.Style, e.MarginV, 48*i)
+		}
+	}
+}
+
+func TestCommentMeta(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	comments := []parser.Comment{{Timeline: 1, No: 7, Timestamp: 1600000000, Text: "弹幕", Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF}}
+
+	if line := eventLine(g.Events(comments)[0]); strings.Contains(line, "Comment:") {
+		t.Errorf("metadata written without CommentMeta: %s", line)
+	}
+
+	g.CommentMeta = true
+	lines := strings.Split(eventLine(g.Events(comments)[0]), "\n")
+	if len(lines) != 3 || lines[0] != "Comment: 0,0:00:01.00,0:00:06.00,R2L,,0,0,0,,no=7 timestamp=1600000000" || !strings.HasPrefix(lines[1], "Dialogue: ") {
+		t.Errorf("event lines = %q", lines)
+	}
+}
+
+// eventTexts 返回事件中去掉覆盖标签后的文本
+func eventTexts(events []Event) []string {
+	var texts []string
+	for _, e := range events {
+		text := e.Text
+		if i := strings.Index(text, "}"); strings.HasPrefix(text, "{") && i >= 0 {
+			text = text[i+1:]
+		}
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+func TestEventsStableOrder(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+
+	// 时间相同时按序号排序，序号也相同时保持原有顺序
+	var comments []parser.Comment
+	var want []string
+	for i := 0; i < 50; i++ {
+		comments = append(comments, parser.Comment{Timeline: 3, No: 1, Text: fmt.Sprint("b", i), Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+		want = append(want, fmt.Sprint("b", i))
+	}
+	comments = append(comments, parser.Comment{Timeline: 3, No: 0, Text: "a", Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+	want = append([]string{"a"}, want...)
+
+	if got := eventTexts(g.Events(comments)); !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %q, want %q", got, want)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	newComments := func() []parser.Comment {
+		return []parser.Comment{
+			{Timeline: 1, Timestamp: 300, Text: "a", Size: 48, Width: 24, Height: 48, Color: 0xFFFFFF},
+			{Timeline: 2, Timestamp: 100, Text: "b", Size: 48, Width: 24, Height: 48, Color: 0xFFFFFF},
+			{Timeline: 3, Timestamp: 200, Text: "c", Size: 48, Width: 24, Height: 48, Color: 0xFFFFFF},
+		}
+	}
+
+	if got := eventTexts(g.Events(newComments())); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("by timeline = %q", got)
+	}
+	g.SortBy = SortByTimestamp
+	if got := eventTexts(g.Events(newComments())); !reflect.DeepEqual(got, []string{"b", "c", "a"}) {
+		t.Errorf("by timestamp = %q", got)
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.PixelAspect = 2
+
+	h := header(t, g)
+	for _, line := range []string{"PlayResX: 1920\n", "PlayResY: 1080\n", "Aspect Ratio: 3.556\n"} {
+		if !strings.Contains(h, line) {
+			t.Errorf("header does not contain %q:\n%s", line, h)
+		}
+	}
+}
+
+func TestRightToLeft(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	comments := []parser.Comment{
+		{Timeline: 1, Text: "مرحبا 123", Size: 48, Width: 200, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 2, Text: "hello", Size: 48, Width: 120, Height: 48, Color: 0xFFFFFF},
+	}
+
+	if got := eventTexts(g.Events(comments))[0]; got != "مرحبا 123" {
+		t.Errorf("text without RightToLeft = %q", got)
+	}
+	g.RightToLeft = true
+	got := eventTexts(g.Events(comments))
+	if got[0] != "\u202bمرحبا 123\u202c" || got[1] != "hello" {
+		t.Errorf("texts = %q", got)
+	}
+}
+
+func TestScrollEndMatchesMove(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.ScrollSpeed = 292
+
+	e := g.Events([]parser.Comment{{Timeline: 1, Text: "很宽的弹幕", Size: 48, Width: 1000, Height: 48, Color: 0xFFFFFF}})[0]
+	// \move不带时间参数，动画覆盖整个事件，移动距离为屏幕宽度加文本宽度
+	if !strings.HasPrefix(e.Text, `{\move(1920,0,-1000,0)}`) {
+		t.Errorf("text = %s, want \\move(1920,0,-1000,0) without times", e.Text)
+	}
+	if e.End-e.Start != 10 {
+		t.Errorf("duration = %v, want (1920+1000)/292 = 10", e.End-e.Start)
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.ScrollSpeed = 240
+	g.MaxDuration = 8
+
+	wide := parser.Comment{Timeline: 1, Text: strings.Repeat("长", 40), Size: 48, Width: 1920, Height: 48, Color: 0xFFFFFF}
+	events := g.Events([]parser.Comment{wide})
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	e := events[0]
+	if d := e.End - e.Start; d != 8 {
+		t.Errorf("duration = %v, want clamped to 8 (unclamped %v)", d, (1920.0+1920)/240)
+	}
+	// \move覆盖被截断后的整个事件，弹幕在8秒内滚完整个距离
+	if !strings.Contains(e.Text, `\move(1920,0,-1920,0)`) || strings.Contains(e.Text, `\move(1920,0,-1920,0,`) {
+		t.Errorf("text = %s, want a \\move spanning the whole event", e.Text)
+	}
+}
+
+func TestShuffleRows(t *testing.T) {
+	var comments []parser.Comment
+	for i := 0; i < 5; i++ {
+		comments = append(comments, parser.Comment{Timeline: 1, No: i, Text: "弹幕", Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+	}
+	generate := func(shuffle bool, seed int64) []string {
+		g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+		g.ShuffleRows = shuffle
+		g.Seed = seed
+		var moves []string
+		for _, e := range g.Events(comments) {
+			moves = append(moves, e.Text[:strings.Index(e.Text, "}")])
+		}
+		return moves
+	}
+
+	baseline := generate(false, 0)
+	for i, m := range baseline {
+		if want := fmt.Sprintf(`{\move(1920,%d,-96,%d)`, 48*i, 48*i); m != want {
+			t.Errorf("baseline event %d = %s, want %s", i, m, want)
+		}
+	}
+
+	shuffled := generate(true, 7)
+	if reflect.DeepEqual(shuffled, baseline) {
+		t.Errorf("seed 7 gave the top-down rows: %q", shuffled)
+	}
+	if again := generate(true, 7); !reflect.DeepEqual(again, shuffled) {
+		t.Errorf("seed 7 is not deterministic:\n%q\n%q", shuffled, again)
+	}
+}
+
+func TestFixedPos(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.FixedPos = true
+
+	var comments []parser.Comment
+	for i := 0; i < 3; i++ {
+		comments = append(comments, parser.Comment{Timeline: 1, No: i, Text: "顶部", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+	}
+	comments = append(comments, parser.Comment{Timeline: 1, No: 3, Text: "底部", Position: 2, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+
+	events := g.Events(comments)
+	want := []string{`{\pos(960,0)}`, `{\pos(960,48)}`, `{\pos(960,96)}`, `{\pos(960,1080)}`}
+	for i, e := range events {
+		if tags := e.Text[:strings.Index(e.Text, "}")+1]; tags != want[i] {
+			t.Errorf("event %d tags = %s, want %s", i, tags, want[i])
+		}
+		if e.MarginV != 0 {
+			t.Errorf("event %d MarginV = %d, want 0 with \\pos", i, e.MarginV)
+		}
+	}
+}
+
+func TestInvert(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.Invert = true
+
+	// 0xFF8000（橙色）反转为0x007FFF，ASS中按BGR顺序写作&HFF7F00&
+	events := g.Events([]parser.Comment{{Timeline: 1, Text: "橙色", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFF8000}})
+	if !strings.Contains(events[0].Text, `\c&HFF7F00&`) {
+		t.Errorf("text = %s, want inverted color \\c&HFF7F00&", events[0].Text)
+	}
+
+	// 白色反转为黑色，描边由黑色变为白色
+	cols := styleColumns(t, strings.TrimSuffix(g.styleLine(g.styles()[0], "R2L"), "\n"))
+	if cols["PrimaryColour"] != "&HCC000000" || cols["OutlineColour"] != "&HFFFFFF" {
+		t.Errorf("style colors = %s, %s", cols["PrimaryColour"], cols["OutlineColour"])
+	}
+}
+
+func TestStylePrefix(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.StylePrefix = "Danmaku"
+
+	h := header(t, g)
+	for _, name := range []string{"DanmakuR2L", "DanmakuTop", "DanmakuBottom"} {
+		if !strings.Contains(h, "Style: "+name+",") {
+			t.Errorf("header does not define %s:\n%s", name, h)
+		}
+	}
+	if strings.Contains(h, "Style: R2L,") || strings.Contains(h, "Style: Top,") {
+		t.Errorf("header still has unprefixed styles:\n%s", h)
+	}
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "滚动", Position: 0, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "顶部", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 2, Text: "底部", Position: 2, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	})
+	var styles []string
+	for _, e := range events {
+		styles = append(styles, e.Style)
+		if line := g.formatEvent(e); !strings.Contains(line, ","+e.Style+",") {
+			t.Errorf("event line does not reference %s: %s", e.Style, line)
+		}
+	}
+	if want := []string{"DanmakuR2L", "DanmakuTop", "DanmakuBottom"}; !reflect.DeepEqual(styles, want) {
+		t.Errorf("event styles = %q, want %q", styles, want)
+	}
+}
+
+func TestStyleAlpha(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.ScrollAlpha = 0.5
+	g.TopAlpha = 0
+
+	// 未单独设置的底部样式使用全局的Alpha
+	want := map[string]string{"R2L": "&H7FFFFFFF", "Top": "&H00FFFFFF", "Bottom": "&HCCFFFFFF"}
+	for _, style := range g.styles() {
+		columns := styleColumns(t, g.styleLine(style, style.Name))
+		if columns["PrimaryColour"] != want[style.Name] {
+			t.Errorf("%s PrimaryColour = %s, want %s", style.Name, columns["PrimaryColour"], want[style.Name])
+		}
+	}
+}
+
+func TestLeftToRight(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "逆向", Position: 3, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "逆向", Position: 3, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	})
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	for i, e := range events {
+		want := fmt.Sprintf(`{\move(-96,%d,1920,%d)}`, 48*i, 48*i)
+		if !strings.HasPrefix(e.Text, want) || e.Style != "R2L" || e.Layer != 0 {
+			t.Errorf("event %d = %+v, want style R2L, layer 0 and %s", i, e, want)
+		}
+	}
+}
+
+func TestUnknownPosition(t *testing.T) {
+	comment := parser.Comment{Timeline: 1, Text: "未来的模式", Position: 99, Size: 48, Width: 240, Height: 48, Color: 0xFFFFFF}
+	for _, tc := range []struct {
+		fallback int
+		style    string
+		move     string
+	}{
+		{-1, "", ""},
+		{0, "R2L", `{\move(1920,0,-240,0)}`},
+		{1, "Top", ""},
+		{3, "R2L", `{\move(-240,0,1920,0)}`},
+	} {
+		g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+		g.UnknownPos = tc.fallback
+		events := g.Events([]parser.Comment{comment})
+		if tc.fallback < 0 {
+			if len(events) != 0 {
+				t.Errorf("fallback -1 kept the comment: %+v", events)
+			}
+			continue
+		}
+		if len(events) != 1 || events[0].Style != tc.style || !strings.HasPrefix(events[0].Text, tc.move) {
+			t.Errorf("fallback %d: events = %+v, want style %s and %q", tc.fallback, events, tc.style, tc.move)
+		}
+	}
+}
+
+func TestFixedLayer(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.FixedLayer = 2
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "滚动", Position: 0, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "顶部", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 2, Text: "底部", Position: 2, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	})
+	want := map[string]int{"R2L": 0, "Top": 2, "Bottom": 2}
+	for _, e := range events {
+		if e.Layer != want[e.Style] {
+			t.Errorf("%s Layer = %d, want %d", e.Style, e.Layer, want[e.Style])
+		}
+		if line := g.formatEvent(e); !strings.HasPrefix(line, fmt.Sprintf("Dialogue: %d,", want[e.Style])) {
+			t.Errorf("event line does not carry the layer: %s", line)
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	// 100像素高的屏幕上同时出现4条48像素高的滚动弹幕，统计互不重合的行数
+	var comments []parser.Comment
+	for i := 0; i < 4; i++ {
+		comments = append(comments, parser.Comment{Timeline: 1, No: i, Text: "弹幕", Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+	}
+	rows := func(overlap float64) []string {
+		g := NewGenerator(1920, 100, "Sans", 48, 0.8, 5, 5)
+		g.Overlap = overlap
+		seen := make(map[string]bool)
+		var distinct []string
+		for _, e := range g.Events(comments) {
+			if move := e.Text[:strings.Index(e.Text, "}")]; !seen[move] {
+				seen[move] = true
+				distinct = append(distinct, move)
+			}
+		}
+		return distinct
+	}
+
+	strict := rows(0)
+	if want := []string{`{\move(1920,0,-96,0)`, `{\move(1920,48,-96,48)`}; !reflect.DeepEqual(strict, want) {
+		t.Errorf("no overlap: rows = %q, want %q", strict, want)
+	}
+	// 允许重叠一半高度时可以放下3行
+	loose := rows(0.5)
+	if want := []string{`{\move(1920,0,-96,0)`, `{\move(1920,24,-96,24)`, `{\move(1920,48,-96,48)`}; !reflect.DeepEqual(loose, want) {
+		t.Errorf("overlap 0.5: rows = %q, want %q", loose, want)
+	}
+}
+
+func TestVertical(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.Vertical = true
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "竖排文字", Position: 1, Size: 48, Width: 192, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "横排", Position: 0, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 2, Text: "latin", Position: 1, Size: 48, Width: 120, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 3, Text: "第二条", Position: 1, Size: 48, Width: 144, Height: 48, Color: 0xFFFFFF},
+	})
+	got := eventTexts(events)
+	want := []string{`竖\N排\N文\N字`, "横排", "latin", `第\N二\N条`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("texts = %q, want %q", got, want)
+	}
+	// 竖排弹幕按竖排后的高度（4个字）堆叠
+	if events[3].MarginV != 4*48+48 {
+		t.Errorf("third top comment MarginV = %d, want %d", events[3].MarginV, 4*48+48)
+	}
+}
+
+func TestCommentAlpha(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	events := g.Events([]parser.Comment{{Timeline: 1, Text: "半透明红色", Position: 1, Size: 48, Width: 240, Height: 48, Color: 0xFF0000, Alpha: 0x80}})
+	if !strings.Contains(events[0].Text, `\c&H0000FF&`) || !strings.Contains(events[0].Text, `\alpha&H7F&`) {
+		t.Errorf("text = %s, want red and \\alpha&H7F&", events[0].Text)
+	}
+}
+
+func TestAbsolutePos(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "定位", Position: 4, X: 0.25, Y: 0.5, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "同一位置", Position: 4, X: 0.25, Y: 0.5, Size: 48, Width: 192, Height: 48, Color: 0xFFFFFF},
+	})
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	// 定位弹幕不占用显示行，坐标相同的弹幕不会被错开
+	for _, e := range events {
+		if !strings.HasPrefix(e.Text, `{\an7\pos(480,540)}`) || e.Style != "Top" || e.MarginV != 0 {
+			t.Errorf("event = %+v, want style Top and \\an7\\pos(480,540)", e)
+		}
+	}
+}
+
+func TestMinDuration(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.ScrollSpeed = 1280
+	g.MinDuration = 3
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "滚动", Position: 0, Size: 48, Width: 640, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "一闪而过", Position: 1, Duration: 0.5, Size: 48, Width: 192, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 2, Text: "足够长", Position: 2, Duration: 4, Size: 48, Width: 144, Height: 48, Color: 0xFFFFFF},
+	})
+	want := map[string]float64{"R2L": 3, "Top": 3, "Bottom": 4}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	for _, e := range events {
+		if d := e.End - e.Start; d != want[e.Style] {
+			t.Errorf("%s duration = %v, want %v", e.Style, d, want[e.Style])
+		}
+		// 滚动弹幕原本2秒滚完，延长后\move仍覆盖整个事件，因此滚动得更慢
+		if e.Style == "R2L" && !strings.HasPrefix(e.Text, `{\move(1920,0,-640,0)}`) {
+			t.Errorf("text = %s, want a \\move spanning the whole event", e.Text)
+		}
+	}
+}
+
+func TestOutlineColor(t *testing.T) {
+	comments := []parser.Comment{
+		{Timeline: 1, No: 0, Text: "红边", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF, OutlineColor: 0xFF0000},
+		{Timeline: 2, No: 1, Text: "黑边", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	}
+	for _, tc := range []struct {
+		invert bool
+		want   string
+	}{
+		{false, `{\3c&H0000FF&}红边`},
+		{true, `\3c&HFFFF00&}红边`},
+	} {
+		g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+		g.Invert = tc.invert
+		events := g.Events(append([]parser.Comment(nil), comments...))
+		if len(events) != 2 {
+			t.Fatalf("got %d events, want 2", len(events))
+		}
+		if !strings.HasSuffix(events[0].Text, tc.want) {
+			t.Errorf("invert %v: text = %s, want %s", tc.invert, events[0].Text, tc.want)
+		}
+		// 没有指定描边颜色时使用样式的描边，不输出\3c
+		if strings.Contains(events[1].Text, `\3c`) {
+			t.Errorf("invert %v: text = %s, want no \\3c", tc.invert, events[1].Text)
+		}
+	}
+}
+
+func TestPalette(t *testing.T) {
+	// 对色盲友好的Okabe-Ito调色板的一部分
+	palette := []int{0xFFFFFF, 0xE69F00, 0x56B4E9, 0x009E73}
+	if got := nearestColor(0x3399FF, palette); got != 0x56B4E9 {
+		t.Errorf("nearestColor(3399FF) = %06X, want 56B4E9", got)
+	}
+
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.Palette = palette
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "天蓝", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0x3399FF},
+		{Timeline: 2, No: 1, Text: "近白", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xF0F0F0},
+		{Timeline: 3, No: 2, Text: "红色", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFF0000},
+	})
+	// 事件中的颜色为BGR顺序；替换为白色的弹幕使用样式颜色，不输出\c
+	for i, want := range []string{`{\c&HE9B456&}天蓝`, `近白`, `{\c&H009FE6&}红色`} {
+		if events[i].Text != want {
+			t.Errorf("event %d text = %s, want %s", i, events[i].Text, want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	for _, tc := range []struct {
+		seconds float64
+		want    string
+	}{
+		{0, "0:00:00.00"},
+		{1.5, "0:00:01.50"},
+		{59.999, "0:00:59.99"},
+		{9*3600 + 59*60 + 59.99, "9:59:59.99"},
+		{40*3600 + 5*60 + 7.25, "40:05:07.25"},
+	} {
+		if got := formatTime(tc.seconds); got != tc.want {
+			t.Errorf("formatTime(%v) = %s, want %s", tc.seconds, got, tc.want)
+		}
+	}
+}
+
+func TestGlow(t *testing.T) {
+	comments := []parser.Comment{
+		{Timeline: 1, No: 0, Text: "滚动", Position: 0, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 1, Text: "顶部", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	}
+	for _, tc := range []struct {
+		blur, shadow float64
+		want         string
+	}{
+		{3, 1, `\blur3\shad1}`},
+		{2.5, 0, `\blur2.5}`},
+		{0, 0, ""},
+	} {
+		g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+		g.Blur, g.GlowShadow = tc.blur, tc.shadow
+		for _, e := range g.Events(append([]parser.Comment(nil), comments...)) {
+			if tc.want == "" {
+				if strings.Contains(e.Text, `\blur`) || strings.Contains(e.Text, `\shad`) {
+					t.Errorf("no glow: text = %s", e.Text)
+				}
+			} else if !strings.Contains(e.Text, tc.want) {
+				t.Errorf("glow %v,%v: text = %s, want %s", tc.blur, tc.shadow, e.Text, tc.want)
+			}
+		}
+	}
+}
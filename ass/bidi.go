@@ -0,0 +1,46 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 双向文本控制字符
+const (
+	rightToLeftEmbedding = "\u202b" // RLE：以从右到左方向嵌入后续文本
+	popDirectional       = "\u202c" // PDF：结束最近一次嵌入
+)
+
+// rtlScripts 从右到左书写的文字
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Arabic,
+	unicode.Hebrew,
+	unicode.Syriac,
+	unicode.Thaana,
+	unicode.Nko,
+}
+
+// isRightToLeft 判断文本的第一个强方向字符是否属于从右到左书写的文字
+// 不包含任何字母时返回false
+func isRightToLeft(text string) bool {
+	for _, r := range text {
+		if unicode.In(r, rtlScripts...) {
+			return true
+		}
+		if unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return false
+}
+
+// embedRightToLeft 将文本的每一行包裹在RLE和PDF控制字符之间
+// 使渲染器以从右到左为基础方向排列整行，数字和标点不会被放到错误的一端
+func embedRightToLeft(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = rightToLeftEmbedding + line + popDirectional
+	}
+	return strings.Join(lines, "\n")
+}
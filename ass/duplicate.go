@@ -0,0 +1,64 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"math"
+	"strings"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// duplicateCounter 按弹幕的处理顺序逐条统计相同文本的重复次数
+// 批量生成和流式生成都逐条调用rank，因此两者的结果相同
+type duplicateCounter struct {
+	window float64              // 统计重复的时间窗口（秒）
+	seen   map[string][]float64 // 各文本在窗口内出现的时间
+}
+
+// newDuplicateCounter 创建统计window秒内重复次数的计数器
+func newDuplicateCounter(window float64) *duplicateCounter {
+	return &duplicateCounter{window: window, seen: make(map[string][]float64)}
+}
+
+// rank 返回弹幕是前window秒内相同文本的第几次重复出现（首次出现为0），并记录本次出现
+// 文本比较前去除首尾空白
+func (d *duplicateCounter) rank(c parser.Comment) int {
+	key := strings.TrimSpace(c.Text)
+
+	// 只保留时间窗口内的出现记录
+	times := d.seen[key][:0]
+	for _, t := range d.seen[key] {
+		if math.Abs(c.Timeline-t) <= d.window {
+			times = append(times, t)
+		}
+	}
+
+	d.seen[key] = append(times, c.Timeline)
+	return len(times)
+}
+
+// dimmedAlpha 返回第rank次重复出现的弹幕降低后的不透明度(1-255)
+// 弹幕没有自带不透明度时以所用样式的不透明度为基准，每重复一次乘以DimDecay
+func (g *Generator) dimmedAlpha(comment parser.Comment, rank int) int {
+	opacity := comment.Alpha
+	if opacity == 0 {
+		opacity = 255 - int(g.positionAlpha(comment.Position)*255)
+	}
+	dimmed := int(math.Round(float64(opacity) * math.Pow(g.DimDecay, float64(rank))))
+	if dimmed < 1 {
+		dimmed = 1
+	}
+	return dimmed
+}
+
+// positionAlpha 返回该位置类型的弹幕所用样式的透明度
+func (g *Generator) positionAlpha(position int) float64 {
+	switch position {
+	case 0, 3:
+		return g.styleAlpha(g.ScrollAlpha)
+	case 2:
+		return g.styleAlpha(g.BottomAlpha)
+	default:
+		return g.styleAlpha(g.TopAlpha)
+	}
+}
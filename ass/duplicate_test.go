@@ -0,0 +1,57 @@
+package ass
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// alphaTag 匹配事件文本中的\alpha覆盖标签
+var alphaTag = regexp.MustCompile(`\\alpha&H([0-9A-F]{2})&`)
+
+// eventOpacity 返回事件的不透明度，没有\alpha标签时返回-1
+func eventOpacity(e Event) int {
+	m := alphaTag.FindStringSubmatch(e.Text)
+	if m == nil {
+		return -1
+	}
+	v, _ := strconv.ParseUint(m[1], 16, 8)
+	return 255 - int(v)
+}
+
+func TestDimDuplicates(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.DimDecay = 0.6
+	g.DimWindow = 10
+
+	// repeat 生成在times出现的相同弹幕，返回按时间排列的不透明度
+	repeat := func(times ...float64) []int {
+		var comments []parser.Comment
+		for i, v := range times {
+			comments = append(comments, parser.Comment{Timeline: v, No: i, Text: "刷屏", Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+		}
+		var opacity []int
+		for _, e := range g.Events(comments) {
+			opacity = append(opacity, eventOpacity(e))
+		}
+		return opacity
+	}
+
+	opacity := repeat(1, 2, 3, 4, 5)
+	if len(opacity) != 5 || opacity[0] != -1 {
+		t.Fatalf("opacity = %v, want the first occurrence to keep the style's", opacity)
+	}
+	for i := 2; i < len(opacity); i++ {
+		if opacity[i] < 1 || opacity[i] >= opacity[i-1] {
+			t.Errorf("opacity = %v, want strictly decreasing after the first occurrence", opacity)
+			break
+		}
+	}
+
+	// 超出时间窗口的重复不降低不透明度
+	if opacity := repeat(1, 30); opacity[1] != -1 {
+		t.Errorf("repeat 29s later has opacity %d, want undimmed", opacity[1])
+	}
+}
@@ -0,0 +1,79 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fontLineLength [Fonts]节中每行编码数据的字符数
+const fontLineLength = 80
+
+// writeFonts 将EmbedFonts中的字体文件编码后写入[Fonts]节
+// 没有要嵌入的字体时不写入任何内容
+func (g *Generator) writeFonts(w io.Writer) error {
+	if len(g.EmbedFonts) == 0 {
+		return nil
+	}
+
+	lines, err := g.fontLines()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n[Fonts]\n"+strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// fontLines 读取并编码EmbedFonts中的字体文件，返回[Fonts]节的各行
+func (g *Generator) fontLines() ([]string, error) {
+	var lines []string
+	for _, path := range g.EmbedFonts {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding font: %w", err)
+		}
+		lines = append(lines, "fontname: "+embeddedFontName(path))
+		lines = append(lines, encodeFont(data)...)
+	}
+	return lines, nil
+}
+
+// embeddedFontName 返回嵌入字体在[Fonts]节中的文件名
+// 按ASS规范在扩展名前加上"_0"（表示常规字形、默认编码），如font.ttf变为font_0.ttf
+func embeddedFontName(path string) string {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	return base[:len(base)-len(ext)] + "_0" + ext
+}
+
+// encodeFont 使用ASS的类UU编码方式编码字体数据
+// 每3个字节拆分为4个6位的值，各加33后作为可打印字符输出，每行80个字符；
+// 结尾剩余1个字节时输出2个字符，剩余2个字节时输出3个字符
+func encodeFont(data []byte) []string {
+	var lines []string
+	var b strings.Builder
+	for i := 0; i < len(data); i += 3 {
+		var group [3]byte
+		n := copy(group[:], data[i:])
+		chars := [4]byte{
+			group[0]>>2 + 33,
+			(group[0]&0x03)<<4 | group[1]>>4 + 33,
+			(group[1]&0x0F)<<2 | group[2]>>6 + 33,
+			group[2]&0x3F + 33,
+		}
+		for _, c := range chars[:n+1] {
+			b.WriteByte(c)
+			if b.Len() == fontLineLength {
+				lines = append(lines, b.String())
+				b.Reset()
+			}
+		}
+	}
+	if b.Len() > 0 {
+		lines = append(lines, b.String())
+	}
+	return lines
+}
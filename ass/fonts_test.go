@@ -0,0 +1,57 @@
+package ass
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeFont(t *testing.T) {
+	// "abc" = 011000 010110 001001 100011，各加33
+	if got := encodeFont([]byte("abc")); !reflect.DeepEqual(got, []string{"97*D"}) {
+		t.Errorf("encodeFont(abc) = %q", got)
+	}
+	// 结尾剩余1个字节时输出2个字符，剩余2个字节时输出3个字符
+	if got := encodeFont([]byte("abcd")); !reflect.DeepEqual(got, []string{"97*D:!"}) {
+		t.Errorf("encodeFont(abcd) = %q", got)
+	}
+	if got := encodeFont([]byte("ab")); !reflect.DeepEqual(got, []string{"97)"}) {
+		t.Errorf("encodeFont(ab) = %q", got)
+	}
+}
+
+func TestEmbedFont(t *testing.T) {
+	dir := t.TempDir()
+	font := filepath.Join(dir, "tiny.ttf")
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := os.WriteFile(font, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.EmbedFonts = []string{font}
+	output := filepath.Join(dir, "out.ass")
+	if err := g.WriteASS(nil, output); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, fonts, ok := strings.Cut(string(out), "\n[Fonts]\n")
+	if !ok {
+		t.Fatalf("no [Fonts] section:\n%s", out)
+	}
+	fonts, _, _ = strings.Cut(fonts, "\n\n")
+	lines := strings.Split(fonts, "\n")
+	// 64字节编码为86个字符，分为80和6个字符两行
+	if len(lines) != 3 || lines[0] != "fontname: tiny_0.ttf" || len(lines[1]) != 80 || len(lines[2]) != 6 {
+		t.Errorf("[Fonts] section = %q", lines)
+	}
+}
@@ -0,0 +1,151 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"math"
+	"math/rand"
+)
+
+// slot 记录占用某一像素行的弹幕的时间和宽度信息
+type slot struct {
+	start float64 // 开始时间（秒）
+	end   float64 // 结束时间（秒）
+	width float64 // 文本宽度（像素）
+}
+
+// rowAllocator 为弹幕分配互不重叠的显示行
+// 以像素为单位记录每一行最后被哪条弹幕占用，各种弹幕位置类型分别独立分配
+type rowAllocator struct {
+	width   int             // 屏幕宽度（像素）
+	height  int             // 可用高度（像素）
+	rows    map[int][]*slot // 各位置类型的行占用情况
+	rng     *rand.Rand      // 非nil时滚动弹幕在所有空闲位置中随机选择，而不是选择最上方的
+	overlap float64         // 滚动弹幕允许与下方弹幕重叠的高度比例(0-1)，0表示不允许重叠
+}
+
+// newRowAllocator 创建一个新的行分配器
+func newRowAllocator(width, height int) *rowAllocator {
+	return &rowAllocator{
+		width:  width,
+		height: height,
+		rows:   make(map[int][]*slot),
+	}
+}
+
+// allocate 为弹幕分配显示行
+// 从第0行开始寻找连续height个空闲的像素行（设置了rng时滚动弹幕随机选择）；
+// 滚动弹幕只检查和占用开头(1-overlap)比例的高度，底部允许与下方的弹幕重叠；
+// 找不到时选择最早被占用的行，允许重叠
+//
+// 参数：
+//   - position: 弹幕位置类型，不同类型互不影响
+//   - s: 弹幕的时间和宽度信息
+//   - height: 弹幕高度（像素）
+//
+// 返回值：
+//   - int: 分配到的起始行，顶部和滚动弹幕从屏幕顶端算起，底部弹幕从屏幕底端算起
+func (a *rowAllocator) allocate(position int, s *slot, height float64) int {
+	rows, ok := a.rows[position]
+	if !ok {
+		rows = make([]*slot, a.height)
+		a.rows[position] = rows
+	}
+
+	h := int(math.Ceil(height))
+	if h > a.height {
+		h = a.height
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	// 滚动弹幕只占用开头的need行，其余部分允许与下方的弹幕重叠
+	scrolling := position == 0 || position == 3
+	need := h
+	if scrolling && a.overlap > 0 {
+		need = h - int(float64(h)*a.overlap)
+		if need < 1 {
+			need = 1
+		}
+	}
+
+	if a.rng != nil && scrolling {
+		if row, ok := a.randomFree(position, rows, s, h, need); ok {
+			a.mark(rows, row, need, s)
+			return row
+		}
+	}
+
+	for row := 0; row+h <= a.height; {
+		free := 0
+		for free < need && a.fits(position, rows[row+free], s) {
+			free++
+		}
+		if free >= need {
+			a.mark(rows, row, need, s)
+			return row
+		}
+		row += free + 1
+	}
+
+	// 没有足够的空闲行，选择空闲或占用者出现最早的行
+	best := 0
+	for row := 0; row+h <= a.height; row++ {
+		if rows[row] == nil {
+			best = row
+			break
+		}
+		if rows[best] != nil && rows[row].start < rows[best].start {
+			best = row
+		}
+	}
+	a.mark(rows, best, need, s)
+	return best
+}
+
+// randomFree 在所有有连续need个空闲像素行、且下方能容纳整个弹幕的起始行中随机选择一个
+func (a *rowAllocator) randomFree(position int, rows []*slot, s *slot, h, need int) (int, bool) {
+	var candidates []int
+	free := 0
+	for row := 0; row < a.height; row++ {
+		if !a.fits(position, rows[row], s) {
+			free = 0
+			continue
+		}
+		free++
+		if start := row - need + 1; free >= need && start+h <= a.height {
+			candidates = append(candidates, start)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	return candidates[a.rng.Intn(len(candidates))], true
+}
+
+// fits 判断新弹幕能否放在被occupant占用的行上而不发生重叠
+func (a *rowAllocator) fits(position int, occupant, s *slot) bool {
+	if occupant == nil {
+		return true
+	}
+
+	// 固定弹幕：先行弹幕消失后才能使用该行
+	if position == 1 || position == 2 {
+		return occupant.end <= s.start
+	}
+
+	// 滚动弹幕（两个方向的计算相同）：先行弹幕的尾部必须已完全进入屏幕，
+	// 且新弹幕的头部到达屏幕另一侧时先行弹幕已完全离开
+	w := float64(a.width)
+	if occupant.start+(occupant.end-occupant.start)*occupant.width/(occupant.width+w) > s.start {
+		return false
+	}
+	return s.start+(s.end-s.start)*w/(s.width+w) >= occupant.end
+}
+
+// mark 将从row开始的h行标记为被s占用
+func (a *rowAllocator) mark(rows []*slot, row, h int, s *slot) {
+	for i := row; i < row+h && i < len(rows); i++ {
+		rows[i] = s
+	}
+}
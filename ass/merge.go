@@ -0,0 +1,246 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// eventFormat 生成器写出的事件字段顺序，合并时要求已有文件使用相同的顺序
+const eventFormat = "Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text"
+
+// styleFormat 生成器写出的样式字段顺序
+const styleFormat = "Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding"
+
+// section 表示ASS文件中的一节，如[Script Info]
+// 第一节之前的内容保存在名称为空的节中
+type section struct {
+	name  string   // 节名称，包括方括号
+	lines []string // 节标题之后的原始行
+}
+
+// readSections 按节读取ASS文件，保留每一行的原始内容
+func readSections(r io.Reader) ([]*section, error) {
+	sections := []*section{{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(sections) == 1 && len(sections[0].lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			sections = append(sections, &section{name: trimmed})
+			continue
+		}
+		current := sections[len(sections)-1]
+		current.lines = append(current.lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// findSection 按名称查找节（不区分大小写）
+// 不存在时创建一个只包含format行（为空时不含）的新节，插入到名为before的节之前，没有该节时追加到末尾
+func findSection(sections []*section, name, format, before string) ([]*section, *section) {
+	at := len(sections)
+	for i, s := range sections {
+		if strings.EqualFold(s.name, name) {
+			return sections, s
+		}
+		if before != "" && strings.EqualFold(s.name, before) && at == len(sections) {
+			at = i
+		}
+	}
+	s := &section{name: name, lines: []string{""}}
+	if format != "" {
+		s.lines = []string{format, ""}
+	}
+	sections = append(sections, nil)
+	copy(sections[at+1:], sections[at:])
+	sections[at] = s
+	return sections, s
+}
+
+// appendLines 将行追加到节的末尾，位于结尾的空行之前
+func (s *section) appendLines(lines ...string) {
+	end := len(s.lines)
+	for end > 0 && strings.TrimSpace(s.lines[end-1]) == "" {
+		end--
+	}
+	tail := append([]string(nil), s.lines[end:]...)
+	s.lines = append(append(s.lines[:end], lines...), tail...)
+}
+
+// styleNames 返回节中已定义的所有样式名
+func (s *section) styleNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range s.lines {
+		value, ok := cutKey(line, "Style")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(value, ",")
+		names[strings.TrimSpace(name)] = true
+	}
+	return names
+}
+
+// checkEventFormat 检查事件节的Format行是否与生成器的字段顺序一致
+func (s *section) checkEventFormat() error {
+	for _, line := range s.lines {
+		value, ok := cutKey(line, "Format")
+		if !ok {
+			continue
+		}
+		fields := strings.Split(value, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if strings.Join(fields, ", ") != strings.TrimPrefix(eventFormat, "Format: ") {
+			return fmt.Errorf("unsupported [Events] format: %s", strings.TrimSpace(value))
+		}
+		return nil
+	}
+	return nil
+}
+
+// checkPlayRes 检查[Script Info]中的PlayResX/PlayResY是否与生成器的画面大小一致
+// 事件的坐标按生成器的Width和Height计算，不一致时合并后的弹幕位置会错乱；
+// 缺少这两项时播放器会按默认的384x288解释，同样视为不一致
+func (s *section) checkPlayRes(width, height int) error {
+	res := map[string]int{}
+	for _, line := range s.lines {
+		for _, key := range []string{"PlayResX", "PlayResY"} {
+			if value, ok := cutKey(line, key); ok {
+				n, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil {
+					return fmt.Errorf("invalid %s: %s", key, strings.TrimSpace(value))
+				}
+				res[key] = n
+			}
+		}
+	}
+	x, okX := res["PlayResX"]
+	y, okY := res["PlayResY"]
+	if !okX || !okY {
+		return fmt.Errorf("missing PlayResX/PlayResY in [Script Info], the danmaku are laid out for %dx%d", width, height)
+	}
+	if x != width || y != height {
+		return fmt.Errorf("PlayRes %dx%d does not match the screen size %dx%d, use -s %dx%d", x, y, width, height, x, y)
+	}
+	return nil
+}
+
+// cutKey 解析"键: 值"形式的行，键不匹配时返回false
+func cutKey(line, key string) (string, bool) {
+	k, value, ok := strings.Cut(line, ":")
+	if !ok || strings.TrimSpace(k) != key {
+		return "", false
+	}
+	return value, true
+}
+
+// MergeASS 将ASS事件合并到已有的ASS字幕文件中并写入output
+// 保留base的[Script Info]和原有样式、事件，追加生成器的样式、事件和嵌入的字体；
+// 样式名与已有样式冲突时加上Danmaku前缀（仍冲突时再加数字后缀）。
+// 事件坐标以生成器的Width和Height为准，base的PlayResX/PlayResY与之不一致或缺失时返回错误
+//
+// 参数：
+//   - events: 要追加的事件列表
+//   - base: 已有ASS文件的路径，可以与output相同
+//   - output: 输出ASS文件的路径
+//
+// 返回值：
+//   - error: 读取、解析或写入失败时返回错误
+func (g *Generator) MergeASS(events []Event, base, output string) error {
+	in, err := os.Open(base)
+	if err != nil {
+		return err
+	}
+	sections, err := readSections(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", base, err)
+	}
+
+	sections, info := findSection(sections, "[Script Info]", "", "")
+	if err := info.checkPlayRes(g.Width, g.Height); err != nil {
+		return fmt.Errorf("error merging into %s: %w", base, err)
+	}
+
+	sections, styles := findSection(sections, "[V4+ Styles]", styleFormat, "[Events]")
+	sections, eventSection := findSection(sections, "[Events]", eventFormat, "")
+	if err := eventSection.checkEventFormat(); err != nil {
+		return fmt.Errorf("error merging into %s: %w", base, err)
+	}
+
+	// 追加样式，重名时改名
+	used := styles.styleNames()
+	rename := make(map[string]string)
+	var styleLines []string
+	for _, style := range g.styles() {
+		name := style.Name
+		for i := 1; used[name]; i++ {
+			name = "Danmaku" + style.Name
+			if i > 1 {
+				name += fmt.Sprint(i)
+			}
+		}
+		used[name] = true
+		rename[style.Name] = name
+		styleLines = append(styleLines, strings.TrimSuffix(g.styleLine(style, name), "\n"))
+	}
+	styles.appendLines(styleLines...)
+
+	// 追加事件，使用改名后的样式
+	var eventLines []string
+	for _, event := range events {
+		event.Style = rename[event.Style]
+		eventLines = append(eventLines, strings.Split(strings.TrimSuffix(eventLine(event), "\n"), "\n")...)
+	}
+	eventSection.appendLines(eventLines...)
+
+	// 追加嵌入的字体
+	if len(g.EmbedFonts) > 0 {
+		fontLines, err := g.fontLines()
+		if err != nil {
+			return err
+		}
+		var fonts *section
+		sections, fonts = findSection(sections, "[Fonts]", "", "[Events]")
+		fonts.appendLines(fontLines...)
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// 节之间至少保留一个空行
+	w := bufio.NewWriter(out)
+	last := ""
+	for _, s := range sections {
+		if s.name != "" {
+			if strings.TrimSpace(last) != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, s.name)
+			last = s.name
+		}
+		for _, line := range s.lines {
+			fmt.Fprintln(w, line)
+			last = line
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,77 @@
+package ass
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// copyBase 将test目录下的ASS文件复制到临时目录，返回副本的路径
+func copyBase(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "test", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMergeASS(t *testing.T) {
+	base := copyBase(t, "merge_base.ass")
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	events := g.Events([]parser.Comment{
+		{Timeline: 2, Text: "顶部弹幕", Position: 1, Size: 48, Width: 192, Height: 48, Color: 0xFFFFFF},
+	})
+	if err := g.MergeASS(events, base, base); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"Title: Episode 1\n",
+		"PlayResX: 1920\n",
+		"Style: Top,Arial,60,",
+		"Style: DanmakuTop,Sans,48,",
+		"Dialogue: 0,0:00:01.00,0:00:04.00,Top,,0,0,0,,字幕第一句\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("merged file does not contain %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, ",DanmakuTop,") || !strings.Contains(out, "顶部弹幕") {
+		t.Errorf("danmaku event missing or not renamed:\n%s", out)
+	}
+}
+
+func TestMergeASSPlayResMismatch(t *testing.T) {
+	base := copyBase(t, "merge_base.ass")
+	g := NewGenerator(1280, 720, "Sans", 48, 0.8, 5, 5)
+	output := filepath.Join(t.TempDir(), "out.ass")
+	err := g.MergeASS(nil, base, output)
+	if err == nil || !strings.Contains(err.Error(), "1920x1080") {
+		t.Errorf("err = %v, want a PlayRes mismatch", err)
+	}
+	if _, statErr := os.Stat(output); statErr == nil {
+		t.Error("output was written despite the mismatch")
+	}
+
+	// 缺少PlayResX/PlayResY时同样拒绝合并
+	noRes := filepath.Join(t.TempDir(), "nores.ass")
+	if err := os.WriteFile(noRes, []byte("[Script Info]\nScriptType: v4.00+\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.MergeASS(nil, noRes, output); err == nil || !strings.Contains(err.Error(), "missing PlayResX") {
+		t.Errorf("err = %v, want missing PlayRes", err)
+	}
+}
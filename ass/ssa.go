@@ -0,0 +1,91 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// SSA v4.00只支持ASS覆盖标签的一个子集，输出SSA时事件按以下方式调整：
+//   - 滚动弹幕不使用\move，改用事件的Banner效果滚动，所在行由MarginV指定
+//   - 定位弹幕不使用\pos，以\a5（左上角对齐）加MarginL、MarginV定位；
+//     固定弹幕忽略FixedPos，始终通过MarginV堆叠
+//   - SSA没有\an、\fad、\alpha、\blur和\shad，淡入淡出、光晕和弹幕自带的透明度被省略，
+//     弹幕只使用样式的AlphaLevel
+//   - SSA没有图层，Layer被忽略
+//
+// \c、\3c、\fn、\fs、\b、\i和\N在SSA中可用，与ASS相同
+
+// SSA v4.00的样式和事件字段顺序
+// 与ASS相比，样式没有Underline、StrikeOut、缩放、间距和旋转字段，描边颜色称为TertiaryColour，
+// 颜色不带Alpha字节；事件以Marked代替Layer
+const (
+	ssaStyleFormat = "Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, TertiaryColour, BackColour, Bold, Italic, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, AlphaLevel, Encoding"
+	ssaEventFormat = "Format: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text"
+)
+
+// ssaStyleLine 生成SSA格式的样式定义行
+// SSA的颜色没有Alpha字节，样式的透明度通过AlphaLevel字段指定；对齐方式换算为SSA的编号
+func (g *Generator) ssaStyleLine(style Style) string {
+	outline := convertColor(0x000000)
+	if g.Invert {
+		outline = convertColor(0xFFFFFF)
+	}
+	return fmt.Sprintf("Style: %s,%s,%s,&H%s,&H%s,&H%s,&H000000,0,0,1,%s,%s,%d,20,20,2,%d,0\n",
+		style.Name, style.FontName, formatFloat(style.FontSize),
+		convertColor(style.PrimaryColor), convertColor(style.PrimaryColor), outline,
+		formatFloat(g.Outline), formatFloat(g.Shadow), ssaAlignment(style.Alignment), int(style.Alpha*255))
+}
+
+// ssaAlignment 将数字键盘布局的对齐方式(1-9)换算为SSA的编号
+// SSA中1-3为底部，5-7为顶部，9-11为中间，各自按左、中、右排列
+func ssaAlignment(align int) int {
+	switch {
+	case align >= 7:
+		return align - 2
+	case align >= 4:
+		return align + 5
+	default:
+		return align
+	}
+}
+
+// ssaEventLine 将单个事件转换为以换行结尾的SSA对话行
+// SSA没有图层，Layer被忽略；带有元信息时与ASS相同，先输出一行Comment
+func ssaEventLine(event Event) string {
+	start := formatTime(event.Start)
+	end := formatTime(event.End)
+
+	var line string
+	if event.Meta != "" {
+		line = fmt.Sprintf("Comment: Marked=0,%s,%s,%s,,0,0,0,,%s\n",
+			start, end, event.Style, event.Meta)
+	}
+
+	line += fmt.Sprintf("Dialogue: Marked=0,%s,%s,%s,,%04d,%04d,%04d,%s,%s\n",
+		start, end, event.Style, event.MarginL, event.MarginR, event.MarginV, event.Effect, event.Text)
+	return line
+}
+
+// ssaBanner 生成滚动弹幕的Banner效果，代替ASS的\move
+// Banner的速度以每移动一像素的毫秒数(1-100)表示，按duration秒内移动屏幕宽度加文本宽度换算，
+// 因此取整后弹幕离开屏幕的时刻与事件结束时刻可能略有偏差；从左到右滚动的弹幕指定lefttoright为1
+func (g *Generator) ssaBanner(comment parser.Comment, duration float64) string {
+	delay := int(math.Round(duration * 1000 / (float64(g.Width) + comment.Width)))
+	if delay < 1 {
+		delay = 1
+	} else if delay > 100 {
+		delay = 100
+	}
+	if comment.Position == 3 {
+		return fmt.Sprintf("Banner;%d;1", delay)
+	}
+	return fmt.Sprintf("Banner;%d", delay)
+}
+
+// ssaAbsoluteMargins 将定位弹幕的坐标换算为左上角对齐时的左边距和垂直边距，代替ASS的\pos
+func (g *Generator) ssaAbsoluteMargins(comment parser.Comment) (marginL, marginV int) {
+	return int(math.Round(comment.X * float64(g.Width))), int(math.Round(comment.Y * float64(g.Height)))
+}
@@ -0,0 +1,66 @@
+package ass
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+func TestSSAHeader(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.SSA = true
+	h := header(t, g)
+
+	for _, want := range []string{
+		"ScriptType: v4.00\n",
+		"\n[V4 Styles]\n" + ssaStyleFormat + "\n",
+		"Style: R2L,Sans,48,&HFFFFFF,&HFFFFFF,&H000000,&H000000,0,0,1,2,0,5,20,20,2,204,0\n",
+		"\n[Events]\n" + ssaEventFormat + "\n",
+	} {
+		if !strings.Contains(h, want) {
+			t.Errorf("header does not contain %q:\n%s", want, h)
+		}
+	}
+	for _, unwanted := range []string{"[V4+ Styles]", "WrapStyle", "ScaledBorderAndShadow"} {
+		if strings.Contains(h, unwanted) {
+			t.Errorf("SSA header contains %q:\n%s", unwanted, h)
+		}
+	}
+}
+
+func TestSSAEvents(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.SSA = true
+	g.FixedPos = true
+	g.FadeIn, g.FadeOut = 200, 200
+	g.Blur = 3
+
+	events := g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "滚动", Position: 0, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF, Alpha: 0x80},
+		{Timeline: 1, No: 1, Text: "逆向", Position: 3, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 1, No: 2, Text: "顶部", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFF0000},
+		{Timeline: 1, No: 3, Text: "定位", Position: 4, X: 0.25, Y: 0.5, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF},
+	})
+	var lines string
+	for _, e := range events {
+		lines += g.formatEvent(e)
+	}
+
+	// 5秒内移动1920+96像素，每像素约2.48毫秒
+	for _, want := range []string{
+		"Dialogue: Marked=0,0:00:01.00,0:00:06.00,R2L,,0000,0000,0000,Banner;2,滚动\n",
+		"Dialogue: Marked=0,0:00:01.00,0:00:06.00,R2L,,0000,0000,0000,Banner;2;1,逆向\n",
+		"Dialogue: Marked=0,0:00:01.00,0:00:06.00,Top,,0000,0000,0000,,{\\c&H0000FF&}顶部\n",
+		"Dialogue: Marked=0,0:00:01.00,0:00:06.00,Top,,0480,0000,0540,,{\\a5}定位\n",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("events do not contain %q:\n%s", want, lines)
+		}
+	}
+	for _, tag := range []string{`\move`, `\pos`, `\an`, `\fad`, `\alpha`, `\blur`} {
+		if strings.Contains(lines, tag) {
+			t.Errorf("SSA events contain %s:\n%s", tag, lines)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"context"
+	"io"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// StreamASS 从通道读取弹幕，边生成边将ASS内容写入w
+// 先写入文件头，之后每生成一个事件立即写入，内存占用不随弹幕数量增长。
+// 与GenerateASS不同，StreamASS不会对弹幕排序：输入必须已按时间线升序排列，
+// 否则固定弹幕的堆叠、滚动弹幕的避让和重复弹幕的统计会出错。
+// 重复弹幕变淡和按帧率对齐与GenerateASS相同。需要缓冲时由调用方包装w
+//
+// 参数：
+//   - ctx: 用于取消生成的上下文
+//   - comments: 按时间线排好序的弹幕，发送完毕后由调用方关闭
+//   - w: 写入目标
+//
+// 返回值：
+//   - error: 写入失败时返回写入错误，ctx被取消时返回ctx.Err()
+func (g *Generator) StreamASS(ctx context.Context, comments <-chan parser.Comment, w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+
+	rows := g.newLayout()
+	dup := g.newDuplicates()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case comment, ok := <-comments:
+			if !ok {
+				return nil
+			}
+			event, ok := g.nextEvent(comment, rows, dup)
+			if !ok {
+				continue
+			}
+			if _, err := io.WriteString(w, g.formatEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ass
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// notifyWriter 记录写入的内容，每次写入后通过written通知（已有未读的通知时不阻塞）
+type notifyWriter struct {
+	mu      sync.Mutex
+	b       strings.Builder
+	written chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.b.Write(p)
+	w.mu.Unlock()
+	select {
+	case w.written <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// waitFor 等待写入的内容满足cond，超时时测试失败
+func (w *notifyWriter) waitFor(t *testing.T, cond func(string) bool) string {
+	t.Helper()
+	for {
+		if out := w.String(); cond(out) {
+			return out
+		}
+		select {
+		case <-w.written:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out, output so far:\n%s", w.String())
+		}
+	}
+}
+
+func (w *notifyWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.b.String()
+}
+
+func TestStreamASS(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	comments := make(chan parser.Comment)
+	w := &notifyWriter{written: make(chan struct{}, 16)}
+	done := make(chan error)
+	go func() {
+		done <- g.StreamASS(context.Background(), comments, w)
+	}()
+
+	// 文件头在收到任何弹幕之前写入
+	w.waitFor(t, func(out string) bool { return strings.Contains(out, eventFormat+"\n") })
+
+	// 每条弹幕生成后立即写入，不等待通道关闭
+	for i, text := range []string{"第一条", "第二条"} {
+		comments <- parser.Comment{Timeline: float64(i + 1), No: i, Text: text, Size: 48, Width: 144, Height: 48, Color: 0xFFFFFF}
+		out := w.waitFor(t, func(out string) bool { return strings.Count(out, "Dialogue: ") == i+1 })
+		if !strings.HasSuffix(out, text+"\n") {
+			t.Errorf("last event is not %s:\n%s", text, out)
+		}
+	}
+
+	close(comments)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// 与批量生成的结果一致
+	batch := header(t, g)
+	for _, e := range g.Events([]parser.Comment{
+		{Timeline: 1, No: 0, Text: "第一条", Size: 48, Width: 144, Height: 48, Color: 0xFFFFFF},
+		{Timeline: 2, No: 1, Text: "第二条", Size: 48, Width: 144, Height: 48, Color: 0xFFFFFF},
+	}) {
+		batch += g.formatEvent(e)
+	}
+	if w.String() != batch {
+		t.Errorf("stream output differs from batch generation:\n%s\n---\n%s", w.String(), batch)
+	}
+}
+
+func TestStreamASSCancel(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var b strings.Builder
+	if err := g.StreamASS(ctx, make(chan parser.Comment), &b); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+// streamString 将弹幕依次发送给StreamASS，返回写出的全部内容
+func streamString(t *testing.T, g *Generator, comments []parser.Comment) string {
+	t.Helper()
+	ch := make(chan parser.Comment, len(comments))
+	for _, c := range comments {
+		ch <- c
+	}
+	close(ch)
+	var b strings.Builder
+	if err := g.StreamASS(context.Background(), ch, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestStreamASSMatchesBatch(t *testing.T) {
+	g := NewGenerator(1920, 1080, "Sans", 48, 0.8, 5, 5)
+	g.FPS = 24
+	g.DimDecay = 0.5
+	g.DimWindow = 10
+
+	var comments []parser.Comment
+	for i := 0; i < 4; i++ {
+		comments = append(comments, parser.Comment{Timeline: 1.01 + float64(i)*0.33, No: i, Text: "刷屏", Position: 1, Size: 48, Width: 96, Height: 48, Color: 0xFFFFFF})
+	}
+
+	events := g.Events(append([]parser.Comment(nil), comments...))
+	batch := header(t, g)
+	for i, e := range events {
+		batch += g.formatEvent(e)
+		for _, v := range []float64{e.Start, e.End} {
+			if frames := v * 24; math.Abs(frames-math.Round(frames)) > 1e-9 {
+				t.Errorf("event %d time %v is not a multiple of 1/24", i, v)
+			}
+		}
+	}
+	// 第2次起的重复弹幕逐渐变淡：样式的不透明度为51，每次减半
+	for i, want := range []string{"", `\alpha&HE5&`, `\alpha&HF2&`, `\alpha&HF9&`} {
+		if want != "" && !strings.Contains(events[i].Text, want) {
+			t.Errorf("event %d = %s, want %s", i, events[i].Text, want)
+		}
+	}
+
+	if stream := streamString(t, g, comments); stream != batch {
+		t.Errorf("stream output differs from batch generation:\n%s\n---\n%s", stream, batch)
+	}
+}
@@ -0,0 +1,46 @@
+// Package ass 实现了ASS字幕文件的生成功能
+package ass
+
+import (
+	"strings"
+	"unicode"
+)
+
+// cjkScripts 可以竖排的中日韩文字
+var cjkScripts = []*unicode.RangeTable{
+	unicode.Han,
+	unicode.Hiragana,
+	unicode.Katakana,
+	unicode.Hangul,
+}
+
+// hasCJK 判断文本中是否包含中日韩文字
+func hasCJK(text string) bool {
+	for _, r := range text {
+		if unicode.In(r, cjkScripts...) {
+			return true
+		}
+	}
+	return false
+}
+
+// verticalText 将文本改为竖排：每个字符单独成行，从上到下排列
+// 原有的换行保留为一个空行，用于分隔竖排的各段；空白字符同样占一行
+//
+// 返回值：
+//   - string: 竖排后的文本
+//   - int: 竖排后的行数
+func verticalText(text string) (string, int) {
+	var b strings.Builder
+	lines := 0
+	for _, r := range text {
+		if lines > 0 {
+			b.WriteByte('\n')
+		}
+		lines++
+		if r != '\n' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), lines
+}
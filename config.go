@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// decodeConfigFile 将JSON配置文件解码到cfg中，只覆盖文件中出现的字段
+// 键名与Config的字段名相同（不区分大小写），未知的键会返回错误
+func decodeConfigFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// restoreFlags 将命令行中显式指定的参数值从cli写回cfg，覆盖配置文件中的值
+// cli为加载配置文件之前cfg的副本；参数通过flag.XxxVar绑定到cfg的字段上，按绑定的地址找到对应的字段。
+// 可多次指定的参数（如-block-regex）整体替换配置文件中的列表，而不是追加
+func restoreFlags(cfg, cli *Config) {
+	v := reflect.ValueOf(cfg).Elem()
+	fields := make(map[uintptr]int, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		fields[v.Field(i).Addr().Pointer()] = i
+	}
+
+	saved := reflect.ValueOf(cli).Elem()
+	flag.Visit(func(f *flag.Flag) {
+		if i, ok := fields[reflect.ValueOf(f.Value).Pointer()]; ok {
+			v.Field(i).Set(saved.Field(i))
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig 将JSON配置写入临时文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDecodeConfigFile(t *testing.T) {
+	path := writeConfig(t, `{"ScreenSize": "1280x720", "FontSize": 36, "BlockRegex": ["^\\d+$"], "Invert": true}`)
+	cfg := &Config{Width: 1920}
+	if err := decodeConfigFile(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ScreenSize != "1280x720" || cfg.FontSize != 36 || !cfg.Invert || !reflect.DeepEqual(cfg.BlockRegex, []string{`^\d+$`}) {
+		t.Errorf("config = %+v", cfg)
+	}
+	if cfg.Width != 1920 {
+		t.Errorf("width = %d, want 1920 kept from before the file was read", cfg.Width)
+	}
+
+	if err := decodeConfigFile(writeConfig(t, `{"FontSzie": 36}`), &Config{}); err == nil {
+		t.Error("unknown key was accepted")
+	}
+}
+
+func TestConfigFlagsOverride(t *testing.T) {
+	path := writeConfig(t, `{"ScreenSize": "1280x720", "FontSize": 36, "BlockRegex": ["hello"], "EmbedFonts": []}`)
+
+	cfg, err := parseTestArgs(t, "-config", path, "-fs", "50", "-block-regex", "top", "test/bilibili_pools.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 1280 || cfg.Height != 720 {
+		t.Errorf("size = %dx%d, want 1280x720 from the file", cfg.Width, cfg.Height)
+	}
+	if cfg.FontSize != 50 {
+		t.Errorf("FontSize = %v, want 50 from the command line", cfg.FontSize)
+	}
+	if !reflect.DeepEqual(cfg.BlockRegex, []string{"top"}) {
+		t.Errorf("BlockRegex = %q, want only the command-line value", cfg.BlockRegex)
+	}
+	// 未出现在文件和命令行中的参数保持默认值
+	if cfg.FontName != "MS PGothic" || cfg.Alpha != 0.8 {
+		t.Errorf("defaults changed: FontName %q, Alpha %v", cfg.FontName, cfg.Alpha)
+	}
+
+	cfg, err = parseTestArgs(t, "-config", path, "test/bilibili_pools.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.BlockRegex, []string{"hello"}) || cfg.FontSize != 36 {
+		t.Errorf("BlockRegex = %q, FontSize = %v, want the file values", cfg.BlockRegex, cfg.FontSize)
+	}
+}
@@ -0,0 +1,477 @@
+// Package main 实现了一个弹幕转ASS字幕的命令行工具
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/m13253/danmaku2ass/ass"
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// job 表示一次转换任务：将若干输入文件合并转换为一个ASS文件
+type job struct {
+	inputs []string // 输入的弹幕文件列表
+	output string   // 输出ASS文件的路径
+	title  string   // 写入ASS文件的标题
+}
+
+// filter 表示一个带名称的弹幕过滤阶段，名称用于统计报告
+type filter struct {
+	name string           // 过滤阶段名称
+	keep parser.Predicate // 过滤条件
+}
+
+// report 记录一次转换任务的统计信息，用于-v输出
+type report struct {
+	parse   parser.Stats   // 解析阶段的统计
+	stages  []string       // 按执行顺序排列的过滤阶段名称
+	dropped map[string]int // 各过滤阶段丢弃的弹幕数
+	unknown int            // 位置类型未知的弹幕数
+	events  int            // 最终生成的事件数
+}
+
+// drop 记录某个过滤阶段丢弃的弹幕数
+func (r *report) drop(stage string, before, after int) {
+	if r.dropped == nil {
+		r.dropped = make(map[string]int)
+	}
+	if _, ok := r.dropped[stage]; !ok {
+		r.stages = append(r.stages, stage)
+	}
+	r.dropped[stage] += before - after
+}
+
+// print 输出统计报告
+func (r *report) print(w io.Writer, output string) {
+	fmt.Fprintf(w, "%s:\n", output)
+
+	formats := make([]string, 0, len(r.parse.Parsed))
+	for format := range r.parse.Parsed {
+		formats = append(formats, string(format))
+	}
+	sort.Strings(formats)
+	for _, format := range formats {
+		fmt.Fprintf(w, "  parsed %s comments: %d\n", format, r.parse.Parsed[parser.Format(format)])
+	}
+
+	fmt.Fprintf(w, "  skipped invalid comments: %d\n", r.parse.Invalid)
+	fmt.Fprintf(w, "  skipped unsupported modes: %d\n", r.parse.Unsupported)
+	fmt.Fprintf(w, "  skipped advanced danmaku (modes 7/8/9): %d\n", r.parse.Advanced)
+	for _, stage := range r.stages {
+		fmt.Fprintf(w, "  dropped by %s: %d\n", stage, r.dropped[stage])
+	}
+	fmt.Fprintf(w, "  unknown positions: %d\n", r.unknown)
+	fmt.Fprintf(w, "  events: %d\n", r.events)
+}
+
+// buildJobs 根据配置划分转换任务
+// 默认将所有输入文件合并为一个输出文件；
+// 分别输出时每个输入文件对应一个任务，输出到目标目录或输入文件所在目录。
+// 没有指定标题时以（第一个）输入文件名作为标题
+func buildJobs(cfg *Config) []job {
+	if !cfg.Split {
+		return []job{{
+			inputs: cfg.InputFiles,
+			output: cfg.OutputFile,
+			title:  jobTitle(cfg, cfg.InputFiles[0]),
+		}}
+	}
+
+	jobs := make([]job, 0, len(cfg.InputFiles))
+	for _, inputFile := range cfg.InputFiles {
+		jobs = append(jobs, job{
+			inputs: []string{inputFile},
+			output: outputPath(inputFile, cfg.OutputDir, "."+cfg.Target),
+			title:  jobTitle(cfg, inputFile),
+		})
+	}
+	return jobs
+}
+
+// jobTitle 返回输出文件的标题：指定了-title时使用该标题，否则使用去掉扩展名的输入文件名
+func jobTitle(cfg *Config, inputFile string) string {
+	if cfg.Title != "" {
+		return cfg.Title
+	}
+	return trimExt(inputBase(inputFile))
+}
+
+// outputPath 计算单个输入文件对应的输出路径
+// 将输入文件的扩展名替换为ext，dir为空时输出到输入文件所在目录（URL输入时为当前目录）
+func outputPath(inputFile, dir, ext string) string {
+	name := trimExt(inputBase(inputFile)) + ext
+	if dir == "" && !isURL(inputFile) {
+		dir = filepath.Dir(inputFile)
+	}
+	return filepath.Join(dir, name)
+}
+
+// errNoInput 表示没有任何输入能成功读取和解析，各输入的错误已输出到标准错误
+var errNoInput = errors.New("no input could be read or parsed")
+
+// errNoEvents 表示过滤后没有剩余的事件（试运行或开启-strict时）
+var errNoEvents = errors.New("no events would be produced (all comments were filtered out or use unsupported modes)")
+
+// convert 执行一次转换任务
+// 读取并合并所有输入文件的弹幕，经过过滤和变换后生成ASS文件
+// 所有输入都无法读取或解析时返回errNoInput，不写入输出文件
+// 开启详细模式时向标准错误输出统计信息，ctx被取消时尽快返回
+// 试运行时只输出各样式的事件数而不写入文件，没有事件时返回errNoEvents；
+// 其他情况下没有事件时输出警告后照常写入，开启-strict时返回errNoEvents；
+// 指定了-merge时将事件合并到已有的ASS文件中，输出格式为json时写入处理后的弹幕而不是ASS事件
+func convert(ctx context.Context, cfg *Config, generator *ass.Generator, opts parser.Options, j job) error {
+	var r report
+	opts.Stats = &r.parse
+
+	comments, err := readComments(ctx, j.inputs, opts, cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	// Every successful parse is recorded in the stats, even one with no comments,
+	// so an empty record means every input failed and must not pass as "no events"
+	if len(r.parse.Parsed) == 0 {
+		return errNoInput
+	}
+	// All randomized features of a job draw from one generator seeded by -seed,
+	// so the same seed reproduces the same output
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	generator.Rand = rng
+
+	comments = processComments(cfg, comments, rng, &r)
+	for _, c := range comments {
+		if !parser.KnownPosition(c.Position) {
+			r.unknown++
+		}
+	}
+	events, err := generator.EventsContext(ctx, comments)
+	if err != nil {
+		return err
+	}
+	// Comments the generator skips (such as unknown positions) are counted as its own stage
+	// so that the parsed count minus all drops equals the event count
+	r.drop("generator", len(comments), len(events))
+	r.events = len(events)
+
+	if cfg.Verbose {
+		r.print(os.Stderr, j.output)
+	}
+
+	if cfg.DryRun {
+		printStyleCounts(os.Stdout, j.output, events)
+		if len(events) == 0 {
+			return errNoEvents
+		}
+		return nil
+	}
+
+	// An empty result is usually a filtering mistake, so do not let it pass silently
+	if len(events) == 0 {
+		if cfg.Strict {
+			return errNoEvents
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s will contain no events; all comments were filtered out or use unsupported modes (run with -v for details)\n", j.output)
+	}
+
+	// Times past 9 hours are written in full, but some renderers expect a single hour digit
+	if cfg.WarnHours {
+		if n := multiDigitHours(events); n > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d events in %s end after 9:59:59.99 and use multi-digit hours, which some renderers do not support\n", n, j.output)
+		}
+	}
+
+	if err := prepareOutput(j.output, cfg.Mkdir); err != nil {
+		return err
+	}
+	generator.Title = j.title
+
+	switch {
+	case cfg.Target == "json":
+		return writeJSON(comments, j.output)
+	case cfg.Merge != "":
+		return generator.MergeASS(events, cfg.Merge, j.output)
+	case cfg.SplitByType:
+		return writeByType(generator, events, j.output)
+	default:
+		return generator.WriteASS(events, j.output)
+	}
+}
+
+// writeByType 将事件按弹幕类型分别写入三个文件，文件名在output的扩展名前加上.scroll、.top或.bottom
+// 三个文件的头部相同，播放器中可以分别开关各类弹幕；某类没有事件时仍然写入只有头部的文件
+func writeByType(generator *ass.Generator, events []ass.Event, output string) error {
+	scroll, top, bottom := generator.EventsByType(events)
+	base, ext := output[:len(output)-len(filepath.Ext(output))], filepath.Ext(output)
+	for _, part := range []struct {
+		name   string
+		events []ass.Event
+	}{
+		{"scroll", scroll},
+		{"top", top},
+		{"bottom", bottom},
+	} {
+		if err := generator.WriteASS(part.events, base+"."+part.name+ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multiDigitHours 返回结束时间的小时数超过一位的事件数
+func multiDigitHours(events []ass.Event) int {
+	n := 0
+	for _, e := range events {
+		if e.End >= ass.SingleDigitHours {
+			n++
+		}
+	}
+	return n
+}
+
+// prepareOutput 检查输出文件所在的目录是否存在
+// 目录不存在时，mkdir为true则创建该目录，否则返回提示使用-mkdir的错误
+func prepareOutput(output string, mkdir bool) error {
+	dir := filepath.Dir(output)
+	info, err := os.Stat(dir)
+	switch {
+	case err == nil && !info.IsDir():
+		return fmt.Errorf("cannot write %s: %s is not a directory", output, dir)
+	case err == nil:
+		return nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	case !mkdir:
+		return fmt.Errorf("output directory %s does not exist (create it first or use -mkdir)", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+	return nil
+}
+
+// writeJSON 将处理后的弹幕以JSON格式写入output
+func writeJSON(comments []parser.Comment, output string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := parser.WriteJSON(file, comments); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// printStyleCounts 输出各样式将生成的事件数，用于-n试运行
+func printStyleCounts(w io.Writer, output string, events []ass.Event) {
+	counts := make(map[string]int)
+	for _, e := range events {
+		counts[e.Style]++
+	}
+
+	styles := make([]string, 0, len(counts))
+	for style := range counts {
+		styles = append(styles, style)
+	}
+	sort.Strings(styles)
+
+	fmt.Fprintf(w, "%s (dry run):\n", output)
+	for _, style := range styles {
+		fmt.Fprintf(w, "  %s: %d\n", style, counts[style])
+	}
+	fmt.Fprintf(w, "  total: %d\n", len(events))
+}
+
+// readComments 读取并解析所有输入文件中的弹幕
+// 输入为URL时按timeout下载，支持gzip和zip压缩文件，无法打开或解析的文件会输出错误信息并跳过
+// 只有ctx被取消时才返回错误
+func readComments(ctx context.Context, inputFiles []string, opts parser.Options, timeout time.Duration) ([]parser.Comment, error) {
+	var sources [][]parser.Comment
+	for _, inputFile := range inputFiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		comments, err := readSource(ctx, inputFile, opts, timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(comments) > 0 {
+			sources = append(sources, comments)
+		}
+	}
+
+	return mergeComments(sources), nil
+}
+
+// readSource 打开并读取单个输入文件中的弹幕，返回前关闭文件并释放下载的内容
+// 每个输入都在读取后立即释放，转换大量文件时不会耗尽文件描述符；
+// 无法打开的文件输出错误信息后跳过，只有ctx被取消时才返回错误
+func readSource(ctx context.Context, inputFile string, opts parser.Options, timeout time.Duration) ([]parser.Comment, error) {
+	file, cleanup, err := openInput(inputFile, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", inputFile, err)
+		return nil, nil
+	}
+	defer cleanup()
+
+	return readInput(ctx, inputFile, file, opts)
+}
+
+// mergeComments 合并多个来源（输入文件或压缩包中的条目）的弹幕
+// 各来源的序号都从头开始，合并后会重复，因此来源多于一个时重新编号：
+// 按时间线排序，时间相同时依次按来源顺序和原序号排序，然后从0开始连续编号。
+// 只有一个来源时保留原序号（如N站弹幕的no属性）
+func mergeComments(sources [][]parser.Comment) []parser.Comment {
+	if len(sources) == 0 {
+		return nil
+	}
+	if len(sources) == 1 {
+		return sources[0]
+	}
+
+	type numbered struct {
+		source  int
+		comment parser.Comment
+	}
+	var all []numbered
+	for i, comments := range sources {
+		for _, c := range comments {
+			all = append(all, numbered{source: i, comment: c})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.comment.Timeline != b.comment.Timeline {
+			return a.comment.Timeline < b.comment.Timeline
+		}
+		if a.source != b.source {
+			return a.source < b.source
+		}
+		return a.comment.No < b.comment.No
+	})
+
+	merged := make([]parser.Comment, len(all))
+	for i, n := range all {
+		merged[i] = n.comment
+		merged[i].No = i
+	}
+	return merged
+}
+
+// processComments 对合并后的弹幕依次执行尺寸缩放、表情移除、过滤、截断、换行和时间变换
+// 随机丢弃弹幕时使用rng，各阶段丢弃的弹幕数记录在r中
+func processComments(cfg *Config, comments []parser.Comment, rng *rand.Rand, r *report) []parser.Comment {
+	// Normalize text first so later filters and deduplication compare canonical forms
+	if cfg.NFC {
+		parser.NormalizeNFC(comments)
+	}
+
+	// Scale sizes from the source reference resolution to the output
+	if cfg.SourceWidth > 0 && cfg.SourceWidth != cfg.Width {
+		parser.ScaleSize(comments, float64(cfg.Width)/float64(cfg.SourceWidth))
+	}
+
+	// Remove emote placeholders before filtering so emote-only comments count as empty
+	if cfg.StripEmotes {
+		parser.StripEmotes(comments)
+	}
+
+	// Apply comment filters to the full text, so that keywords past the
+	// truncation point still match
+	for _, f := range buildFilters(cfg) {
+		before := len(comments)
+		comments = parser.FilterComments(comments, f.keep)
+		r.drop(f.name, before, len(comments))
+	}
+
+	// Shorten paste spam before wrapping so the ellipsis stays on the last line
+	if cfg.Truncate {
+		parser.TruncateText(comments, cfg.MaxLength)
+	}
+
+	// Break overlong fixed comments into several lines
+	if cfg.WrapWidth > 0 {
+		parser.WrapText(comments, float64(cfg.WrapWidth))
+	}
+
+	// Shift the clipped range so that it starts at zero
+	if cfg.StartTime > 0 {
+		parser.ShiftTimeline(comments, -cfg.StartTime)
+	}
+
+	// Adjust timelines for altered playback speed
+	if cfg.Speed != 1 {
+		parser.ScaleTimeline(comments, cfg.Speed)
+	}
+
+	// Apply the global delay; like -start, comments moved before zero are dropped
+	if cfg.Delay != 0 {
+		parser.ShiftTimeline(comments, cfg.Delay)
+		if cfg.Delay < 0 {
+			before := len(comments)
+			comments = parser.FilterComments(comments, parser.InTimeRange(0, 0))
+			r.drop("delay", before, len(comments))
+		}
+	}
+
+	// Thin out dense bursts
+	if cfg.Reduce > 0 {
+		before := len(comments)
+		comments = parser.ReduceDensity(comments, cfg.Reduce, 1, cfg.ReduceLimit, rng)
+		r.drop("reduce", before, len(comments))
+	}
+
+	return comments
+}
+
+// buildFilters 根据配置构造弹幕过滤阶段列表
+// 过滤条件按顺序依次应用于合并后的弹幕列表
+func buildFilters(cfg *Config) []filter {
+	var filters []filter
+
+	if !cfg.KeepEmpty {
+		filters = append(filters, filter{"empty", parser.NotBlank()})
+	}
+	if cfg.MaxLength > 0 && !cfg.Truncate {
+		filters = append(filters, filter{"max-length", parser.MaxLength(cfg.MaxLength)})
+	}
+	if cfg.Pool >= 0 {
+		filters = append(filters, filter{"pool", parser.InPool(cfg.Pool)})
+	}
+	if cfg.StartTime > 0 || cfg.EndTime > 0 {
+		filters = append(filters, filter{"time range", parser.InTimeRange(cfg.StartTime, cfg.EndTime)})
+	}
+	if len(cfg.BlockWords) > 0 {
+		filters = append(filters, filter{"block", parser.NotContaining(cfg.BlockWords)})
+	}
+	if len(cfg.BlockRegexps) > 0 {
+		filters = append(filters, filter{"block-regex", parser.NotMatching(cfg.BlockRegexps)})
+	}
+	if cfg.OnlyFixed {
+		filters = append(filters, filter{"only-fixed", parser.FixedOnly()})
+	}
+	if cfg.OnlyScroll {
+		filters = append(filters, filter{"only-scroll", parser.ScrollOnly()})
+	}
+	if cfg.SkipHidden {
+		filters = append(filters, filter{"hidden", parser.NotHidden()})
+	}
+	if len(cfg.Users) > 0 {
+		filters = append(filters, filter{"user", parser.FromUsers(cfg.Users)})
+	}
+	if len(cfg.BlockUsers) > 0 {
+		filters = append(filters, filter{"block-user", parser.NotFromUsers(cfg.BlockUsers)})
+	}
+
+	return filters
+}
@@ -0,0 +1,673 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+func TestProcessCommentsTimeRange(t *testing.T) {
+	cfg := &Config{KeepEmpty: true, Speed: 1, StartTime: 10, EndTime: 20}
+	comments := []parser.Comment{
+		{Timeline: 5, Text: "a"},
+		{Timeline: 10, Text: "b"},
+		{Timeline: 12.5, Text: "c"},
+		{Timeline: 20, Text: "d"},
+	}
+
+	var r report
+	got := processComments(cfg, comments, rand.New(rand.NewSource(0)), &r)
+	if len(got) != 2 {
+		t.Fatalf("kept %d comments, want 2", len(got))
+	}
+	// 截取范围的开始时间平移到0
+	if got[0].Timeline != 0 || got[1].Timeline != 2.5 {
+		t.Errorf("timelines = %v, %v, want 0, 2.5", got[0].Timeline, got[1].Timeline)
+	}
+	if r.dropped["time range"] != 2 {
+		t.Errorf("dropped by time range = %d, want 2", r.dropped["time range"])
+	}
+}
+
+func TestProcessCommentsBlank(t *testing.T) {
+	comments := []parser.Comment{{Text: "a"}, {Text: ""}, {Text: " \t"}, {Text: "\n"}, {Text: " b "}}
+
+	var r report
+	got := processComments(&Config{Speed: 1}, comments, rand.New(rand.NewSource(0)), &r)
+	if len(got) != 2 || got[0].Text != "a" || got[1].Text != " b " {
+		t.Errorf("kept %+v, want a and \" b \"", got)
+	}
+	if r.dropped["empty"] != 3 {
+		t.Errorf("dropped by empty = %d, want 3", r.dropped["empty"])
+	}
+
+	comments = []parser.Comment{{Text: "a"}, {Text: " "}}
+	if got := processComments(&Config{Speed: 1, KeepEmpty: true}, comments, rand.New(rand.NewSource(0)), &r); len(got) != 2 {
+		t.Errorf("-keep-empty kept %d comments, want 2", len(got))
+	}
+}
+
+func TestProcessCommentsSourceWidth(t *testing.T) {
+	cfg := &Config{Speed: 1, Width: 1280, SourceWidth: 1920}
+	comments := []parser.Comment{{Text: "弹幕", Size: 48, Width: 96, Height: 48}}
+
+	var r report
+	got := processComments(cfg, comments, rand.New(rand.NewSource(0)), &r)
+	if c := got[0]; c.Size != 32 || c.Width != 64 || c.Height != 32 {
+		t.Errorf("size = %v, %vx%v, want 32, 64x32", c.Size, c.Width, c.Height)
+	}
+}
+
+func TestProcessCommentsMaxLength(t *testing.T) {
+	input := func() []parser.Comment {
+		return []parser.Comment{{Text: "12345"}, {Text: "123456"}, {Text: "前面很长很长剧透在后"}}
+	}
+
+	// 不截断时超过5个字符的弹幕被丢弃
+	var r report
+	got := processComments(&Config{Speed: 1, MaxLength: 5}, input(), rand.New(rand.NewSource(0)), &r)
+	if len(got) != 1 || got[0].Text != "12345" || r.dropped["max-length"] != 2 {
+		t.Errorf("-max-length 5: kept %+v, dropped %d", got, r.dropped["max-length"])
+	}
+
+	// 截断在过滤之后：截断点之后的屏蔽词仍然生效
+	r = report{}
+	cfg := &Config{Speed: 1, MaxLength: 5, Truncate: true, BlockWords: []string{"剧透"}}
+	got = processComments(cfg, input(), rand.New(rand.NewSource(0)), &r)
+	if want := []string{"12345", "1234…"}; len(got) != 2 || got[0].Text != want[0] || got[1].Text != want[1] {
+		t.Errorf("-truncate: kept %+v, want %q", got, want)
+	}
+}
+
+func TestProcessCommentsDelay(t *testing.T) {
+	timelines := func(comments []parser.Comment) []float64 {
+		var got []float64
+		for _, c := range comments {
+			got = append(got, c.Timeline)
+		}
+		return got
+	}
+	input := func() []parser.Comment {
+		return []parser.Comment{{Timeline: 0.5, Text: "a"}, {Timeline: 1, Text: "b"}, {Timeline: 4, Text: "c"}}
+	}
+
+	var r report
+	got := processComments(&Config{Speed: 1, Delay: 2.5}, input(), rand.New(rand.NewSource(0)), &r)
+	if want := []float64{3, 3.5, 6.5}; !reflect.DeepEqual(timelines(got), want) {
+		t.Errorf("delay 2.5: timelines = %v, want %v", timelines(got), want)
+	}
+
+	// 提前到0之前的弹幕被丢弃
+	got = processComments(&Config{Speed: 1, Delay: -1}, input(), rand.New(rand.NewSource(0)), &r)
+	if want := []float64{0, 3}; !reflect.DeepEqual(timelines(got), want) {
+		t.Errorf("delay -1: timelines = %v, want %v", timelines(got), want)
+	}
+	if r.dropped["delay"] != 1 {
+		t.Errorf("dropped by delay = %d, want 1", r.dropped["delay"])
+	}
+}
+
+func TestConvertOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := convertArgs(t, "-o", dir, "test/bilibili_pools.xml", "test/niconico_sizes.xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"bilibili_pools.ass", "niconico_sizes.ass"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "Dialogue:") {
+			t.Errorf("%s has no events", name)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("wrote %d files, want 2", len(entries))
+	}
+}
+
+// captureStderr 执行f并返回其间写入标准错误的内容
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestConvertVerbose(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.ass")
+	var err error
+	stderr := captureStderr(t, func() {
+		err = convertArgs(t, "-v", "-o", output, "test/ir_positions.json")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"  parsed IR comments: 4\n",
+		"  dropped by empty: 1\n",
+		"  dropped by generator: 1\n",
+		"  unknown positions: 1\n",
+		"  events: 2\n",
+	} {
+		if !strings.Contains(stderr, line) {
+			t.Errorf("report does not contain %q:\n%s", line, stderr)
+		}
+	}
+}
+
+func TestConvertDryRun(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.ass")
+	if err := convertArgs(t, "-n", "-o", output, "test/bilibili_pools.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s (stat error %v)", output, err)
+	}
+}
+
+func TestMergeCommentsNumbering(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.xml")
+	second := filepath.Join(dir, "b.xml")
+	for path, xml := range map[string]string{
+		first:  `<i><d p="1,1,25,16777215,0,0,u,1">a0</d><d p="3,1,25,16777215,0,0,u,2">a1</d></i>`,
+		second: `<i><d p="1,1,25,16777215,0,0,u,1">b0</d><d p="2,1,25,16777215,0,0,u,2">b1</d></i>`,
+	} {
+		if err := os.WriteFile(path, []byte(xml), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	comments, err := readComments(context.Background(), []string{first, second}, parser.DefaultOptions(25), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 时间相同时先来源顺序，然后从0开始连续编号
+	var got []string
+	for i, c := range comments {
+		if c.No != i {
+			t.Errorf("%s No = %d, want %d", c.Text, c.No, i)
+		}
+		got = append(got, c.Text)
+	}
+	if strings.Join(got, ",") != "a0,b0,b1,a1" {
+		t.Errorf("order = %v, want a0,b0,b1,a1", got)
+	}
+}
+
+func TestConvertThroughIR(t *testing.T) {
+	dir := t.TempDir()
+	direct := filepath.Join(dir, "direct.ass")
+	ir := filepath.Join(dir, "comments.json")
+	viaIR := filepath.Join(dir, "via-ir.ass")
+	for _, args := range [][]string{
+		{"-title", "test", "-o", direct, "test/bilibili_pools.xml"},
+		{"-t", "json", "-o", ir, "test/bilibili_pools.xml"},
+		{"-title", "test", "-o", viaIR, ir},
+	} {
+		if err := convertArgs(t, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(viaIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("Bilibili→JSON→ASS differs from direct conversion:\n%s\n---\n%s", got, want)
+	}
+	if !strings.Contains(string(got), "Dialogue: ") {
+		t.Errorf("output has no events:\n%s", got)
+	}
+}
+
+func TestConvertMkdir(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "a", "b", "out.ass")
+
+	err := convertArgs(t, "-o", output, "test/bilibili_pools.xml")
+	if err == nil || !strings.Contains(err.Error(), "does not exist") || !strings.Contains(err.Error(), "-mkdir") {
+		t.Errorf("err = %v, want a hint to use -mkdir", err)
+	}
+	if _, statErr := os.Stat(filepath.Dir(output)); !os.IsNotExist(statErr) {
+		t.Errorf("directory was created without -mkdir (stat error %v)", statErr)
+	}
+
+	if err := convertArgs(t, "-mkdir", "-o", output, "test/bilibili_pools.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("output not written with -mkdir: %v", err)
+	}
+}
+
+func TestConvertTitle(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		args  []string
+		title string
+	}{
+		{nil, "bilibili_pools"},
+		{[]string{"-title", "第1话"}, "第1话"},
+	} {
+		output := filepath.Join(dir, "out.ass")
+		args := append(append(tc.args, "-o", output), "test/bilibili_pools.xml")
+		if err := convertArgs(t, args...); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "\nTitle: "+tc.title+"\n") {
+			t.Errorf("%v: header does not have title %s:\n%.200s", tc.args, tc.title, data)
+		}
+	}
+}
+
+func TestMergedSourceSizes(t *testing.T) {
+	sizes := func(scale parser.ScaleMap) map[string]float64 {
+		opts := parser.DefaultOptions(40)
+		opts.FormatScale = scale
+		comments, err := readComments(context.Background(), []string{"test/bilibili_pools.xml", "test/niconico_sizes.xml"}, opts, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]float64)
+		for _, c := range comments {
+			got[c.Text] = c.Size
+		}
+		return got
+	}
+
+	// 两种格式的普通弹幕都使用-fs指定的字号
+	got := sizes(nil)
+	if got["普通弹幕"] != 40 || got["普通"] != 40 || got["大号"] != 60 {
+		t.Errorf("sizes = %v, want normal comments of both formats at 40", got)
+	}
+
+	got = sizes(parser.ScaleMap{parser.FormatNiconico: 0.9})
+	if got["普通弹幕"] != 40 || got["普通"] != 36 {
+		t.Errorf("with niconico=0.9: sizes = %v", got)
+	}
+}
+
+func TestConvertSkipHidden(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		args   []string
+		events int
+	}{
+		{nil, 4},
+		{[]string{"-skip-hidden"}, 2},
+	} {
+		output := filepath.Join(dir, "out.ass")
+		if err := convertArgs(t, append(append(tc.args, "-o", output), "test/bilibili_hidden.xml")...); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(data), "Dialogue:"); n != tc.events {
+			t.Errorf("%v: wrote %d events, want %d", tc.args, n, tc.events)
+		}
+		if len(tc.args) > 0 && (strings.Contains(string(data), "被举报的弹幕") || strings.Contains(string(data), "被屏蔽的弹幕")) {
+			t.Errorf("-skip-hidden kept a hidden comment:\n%s", data)
+		}
+	}
+}
+
+func TestConvertCustomParser(t *testing.T) {
+	// 格式注册是全局的，使用不会与其他测试冲突的格式名
+	parser.RegisterParser("test-semicolon", func(head []byte) bool {
+		return strings.HasPrefix(string(head), "#semicolon danmaku\n")
+	}, func(r io.Reader, fontSize float64) ([]parser.Comment, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var comments []parser.Comment
+		for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[1:] {
+			timeline, text, _ := strings.Cut(line, ";")
+			var c parser.Comment
+			if _, err := fmt.Sscan(timeline, &c.Timeline); err != nil {
+				return nil, err
+			}
+			c.No, c.Text, c.Size, c.Color = i, text, fontSize, 0xFFFFFF
+			c.Width, c.Height = parser.EstimateTextSize(text, fontSize)
+			comments = append(comments, c)
+		}
+		return comments, nil
+	})
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "custom.txt")
+	if err := os.WriteFile(input, []byte("#semicolon danmaku\n1.5;第一条\n3;第二条\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := parser.ProbeFormat(file)
+	file.Close()
+	if err != nil || format != "test-semicolon" {
+		t.Fatalf("probed %v, %v, want test-semicolon", format, err)
+	}
+
+	output := filepath.Join(dir, "out.ass")
+	if err := convertArgs(t, "-o", output, input); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Dialogue: 0,0:00:01.50,", "第一条\n", "Dialogue: 0,0:00:03.00,", "第二条\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("output does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestConvertSeed(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "dense.xml")
+	var b strings.Builder
+	b.WriteString("<i>\n")
+	for i := 0; i < 60; i++ {
+		fmt.Fprintf(&b, "<d p=\"%.1f,1,25,16777215,1600000000,0,u%d,%d\">弹幕%d</d>\n", float64(i)/10, i, i, i)
+	}
+	b.WriteString("</i>\n")
+	if err := os.WriteFile(input, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// run 以args转换input，返回输出的ASS内容
+	run := func(name string, args ...string) string {
+		output := filepath.Join(dir, name)
+		if err := convertArgs(t, append(append([]string{"-o", output}, args...), input)...); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	first := run("a.ass", "-reduce", "0.5", "-shuffle-rows", "-seed", "42")
+	if second := run("b.ass", "-reduce", "0.5", "-shuffle-rows", "-seed", "42"); second != first {
+		t.Error("two runs with -seed 42 gave different output")
+	}
+	if n := strings.Count(first, "Dialogue:"); n == 0 || n >= 60 {
+		t.Errorf("-reduce 0.5 kept %d of 60 comments", n)
+	}
+
+	// 不指定-seed时使用固定的默认种子，输出同样确定
+	if run("c.ass", "-reduce", "0.5", "-shuffle-rows") != run("d.ass", "-reduce", "0.5", "-shuffle-rows") {
+		t.Error("two runs without -seed gave different output")
+	}
+}
+
+func TestConvertNoEvents(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "unsupported.xml")
+	if err := os.WriteFile(input, []byte(`<i>
+<d p="1,8,25,16777215,0,0,u,1">var a = 1;</d>
+<d p="2,99,25,16777215,0,0,u,2">未知模式</d>
+</i>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认只输出警告，仍然写入只有文件头的ASS
+	output := filepath.Join(dir, "out.ass")
+	var err error
+	stderr := captureStderr(t, func() {
+		err = convertArgs(t, "-o", output, input)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, "Warning: "+output+" will contain no events") {
+		t.Errorf("stderr = %q, want a no-events warning", stderr)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("output was not written: %v", err)
+	}
+
+	// -strict时返回错误且不写入文件
+	strict := filepath.Join(dir, "strict.ass")
+	if err := convertArgs(t, "-strict", "-o", strict, input); !errors.Is(err, errNoEvents) {
+		t.Errorf("-strict error = %v, want errNoEvents", err)
+	}
+	if _, err := os.Stat(strict); !os.IsNotExist(err) {
+		t.Errorf("-strict wrote %s (stat error %v)", strict, err)
+	}
+}
+
+func TestConvertAllInputsFail(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.xml.gz")
+	if err := os.WriteFile(corrupt, []byte("\x1f\x8bnot really gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "out.ass")
+	var err error
+	stderr := captureStderr(t, func() {
+		err = convertArgs(t, "-o", output, corrupt)
+	})
+	if !errors.Is(err, errNoInput) {
+		t.Errorf("err = %v, want errNoInput", err)
+	}
+	if !strings.Contains(stderr, "Error decompressing "+corrupt) {
+		t.Errorf("stderr = %q, want the decompression error", stderr)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("wrote %s although every input failed (stat error %v)", output, err)
+	}
+
+	// 只要有一个输入成功就照常转换
+	captureStderr(t, func() {
+		err = convertArgs(t, "-o", output, corrupt, "test/bilibili_pools.xml")
+	})
+	if err != nil {
+		t.Errorf("one good input: %v", err)
+	}
+}
+
+// openFiles 返回进程当前打开的文件描述符数量，不支持/proc时跳过测试
+func openFiles(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count open files: %v", err)
+	}
+	return len(entries)
+}
+
+func TestConvertClosesFiles(t *testing.T) {
+	data, err := os.ReadFile("test/bilibili_pools.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	inputs := make([]string, 200)
+	for i := range inputs {
+		inputs[i] = filepath.Join(dir, fmt.Sprintf("in%03d.xml", i))
+		if err := os.WriteFile(inputs[i], data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := filepath.Join(dir, "out")
+	if err := os.Mkdir(output, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 先转换一次，排除运行时首次使用时打开的描述符
+	if err := convertArgs(t, "-o", output, inputs[0]); err != nil {
+		t.Fatal(err)
+	}
+	before := openFiles(t)
+	if err := convertArgs(t, append([]string{"-o", output}, inputs...)...); err != nil {
+		t.Fatal(err)
+	}
+	if after := openFiles(t); after > before+2 {
+		t.Errorf("%d files open after converting %d inputs, %d before", after, len(inputs), before)
+	}
+}
+
+func TestConvertNFCDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "nfd.xml")
+	// 同一文本先以分解形式(NFD)、再以组合形式(NFC)出现
+	if err := os.WriteFile(input, []byte("<i>\n"+
+		"<d p=\"1,1,25,16777215,1600000000,0,u,1\">Cafe\u0301</d>\n"+
+		"<d p=\"2,1,25,16777215,1600000001,0,u,2\">Caf\u00e9</d>\n"+
+		"</i>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// run 以args转换input，返回输出的ASS内容
+	run := func(args ...string) string {
+		output := filepath.Join(dir, "out.ass")
+		if err := convertArgs(t, append(append([]string{"-dim-duplicates", "0.5", "-o", output}, args...), input)...); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// 默认转换为NFC后两条视为重复，第二条变淡
+	if out := run(); strings.Count(out, "Caf\u00e9\n") != 2 || strings.Count(out, `\alpha`) != 1 {
+		t.Errorf("with -nfc, want both texts in NFC and the second dimmed:\n%s", out)
+	}
+	if out := run("-nfc=false"); strings.Contains(out, `\alpha`) {
+		t.Errorf("with -nfc=false, NFD and NFC texts were treated as duplicates:\n%s", out)
+	}
+}
+
+func TestConvertSplitByType(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.ass")
+	if err := convertArgs(t, "-split-by-type", "-o", output, "test/bilibili_pools.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("-split-by-type also wrote %s (stat error %v)", output, err)
+	}
+
+	var headers []string
+	for _, part := range []struct {
+		name  string
+		style string
+		texts []string
+	}{
+		{"scroll", "R2L", []string{"普通弹幕", "特殊池弹幕", "又一条字幕池弹幕"}},
+		{"top", "Top", []string{"字幕池弹幕"}},
+		{"bottom", "Bottom", []string{"底部弹幕"}},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "out."+part.name+".ass"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		head, events, ok := strings.Cut(string(data), "[Events]\n")
+		if !ok {
+			t.Fatalf("out.%s.ass has no [Events] section:\n%s", part.name, data)
+		}
+		headers = append(headers, head)
+
+		var texts []string
+		for _, line := range strings.Split(events, "\n") {
+			if !strings.HasPrefix(line, "Dialogue: ") {
+				continue
+			}
+			fields := strings.SplitN(line, ",", 10)
+			if fields[3] != part.style {
+				t.Errorf("out.%s.ass contains a %s event: %s", part.name, fields[3], line)
+			}
+			texts = append(texts, fields[9][strings.LastIndex(fields[9], "}")+1:])
+		}
+		if !reflect.DeepEqual(texts, part.texts) {
+			t.Errorf("out.%s.ass texts = %q, want %q", part.name, texts, part.texts)
+		}
+	}
+	if headers[1] != headers[0] || headers[2] != headers[0] {
+		t.Errorf("headers differ:\n%s\n---\n%s\n---\n%s", headers[0], headers[1], headers[2])
+	}
+}
+
+func TestConvertWarnHours(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "long.xml")
+	// 40小时后的弹幕
+	if err := os.WriteFile(input, []byte(`<i>
+<d p="1,1,25,16777215,1600000000,0,u,1">开头</d>
+<d p="144000,1,25,16777215,1600000001,0,u,2">四十小时后</d>
+</i>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "out.ass")
+	var err error
+	stderr := captureStderr(t, func() {
+		err = convertArgs(t, "-warn-hours", "-o", output, input)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, "Warning: 1 events in "+output+" end after 9:59:59.99") {
+		t.Errorf("stderr = %q, want a multi-digit hours warning", stderr)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Dialogue: 0,40:00:00.00,40:00:05.00,") {
+		t.Errorf("output does not keep the full hours:\n%s", data)
+	}
+
+	// 不指定-warn-hours时不警告
+	stderr = captureStderr(t, func() {
+		err = convertArgs(t, "-o", output, input)
+	})
+	if err != nil || strings.Contains(stderr, "multi-digit hours") {
+		t.Errorf("without -warn-hours: err = %v, stderr = %q", err, stderr)
+	}
+}
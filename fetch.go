@@ -0,0 +1,100 @@
+// Package main 实现了一个弹幕转ASS字幕的命令行工具
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isURL 判断输入参数是否为http(s)地址
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// inputBase 返回输入参数的文件名部分
+// URL取路径的最后一段，无法解析时返回"danmaku"
+func inputBase(input string) string {
+	if !isURL(input) {
+		return filepath.Base(input)
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return "danmaku"
+	}
+	base := path.Base(u.Path)
+	if base == "/" || base == "." {
+		return "danmaku"
+	}
+	return base
+}
+
+// maxDownloadSize 下载的弹幕文件的大小上限（字节），下载的内容保存在内存中
+var maxDownloadSize int64 = 256 << 20
+
+// inputFile 打开的输入：本地文件为*os.File，下载的内容为内存中的*bytes.Reader
+// 检测压缩格式后需要回到开头，zip压缩包需要随机读取
+type inputFile interface {
+	io.Reader
+	io.Seeker
+	io.ReaderAt
+}
+
+// openInput 打开输入文件
+// 输入为http(s)地址时下载到内存中，不写入临时文件
+//
+// 参数：
+//   - input: 输入文件路径或URL
+//   - timeout: 下载超时时间
+//
+// 返回值：
+//   - inputFile: 打开的输入，位置在开头
+//   - func(): 关闭文件的函数
+//   - error: 打开或下载失败时返回错误
+func openInput(input string, timeout time.Duration) (inputFile, func(), error) {
+	if !isURL(input) {
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, func() { file.Close() }, nil
+	}
+
+	data, err := download(input, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(data), func() {}, nil
+}
+
+// download 下载URL指向的弹幕文件，内容超过maxDownloadSize时返回错误
+func download(rawURL string, timeout time.Duration) ([]byte, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	// 多读一个字节，以区分恰好达到上限和超过上限
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxDownloadSize {
+		return nil, fmt.Errorf("download exceeds %d bytes", maxDownloadSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("test")))
+	defer server.Close()
+
+	file, cleanup, err := openInput(server.URL+"/bilibili_pools.xml", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	// 下载的内容保存在内存中，不写入临时文件
+	if _, ok := file.(*bytes.Reader); !ok {
+		t.Errorf("download is a %T, want an in-memory *bytes.Reader", file)
+	}
+	got, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("test/bilibili_pools.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("downloaded content differs from the served file")
+	}
+
+	if _, _, err := openInput(server.URL+"/missing.xml", time.Second); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing file: err = %v, want a 404 status error", err)
+	}
+
+	// 超过大小上限的下载被拒绝
+	defer func(size int64) { maxDownloadSize = size }(maxDownloadSize)
+	maxDownloadSize = int64(len(want)) - 1
+	if _, _, err := openInput(server.URL+"/bilibili_pools.xml", time.Second); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("oversized download: err = %v, want a size error", err)
+	}
+}
+
+func TestConvertURL(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("test")))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "out.ass")
+	if err := convertArgs(t, "-o", output, server.URL+"/bilibili_pools.xml"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "Dialogue:"); n != 5 {
+		t.Errorf("wrote %d events, want 5", n)
+	}
+	if !strings.Contains(string(data), "Title: bilibili_pools\n") {
+		t.Error("title is not taken from the URL path")
+	}
+}
+
+func TestConvertURLErrorName(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("test")))
+	defer server.Close()
+
+	input := server.URL + "/bilibili_truncated.xml"
+	var err error
+	stderr := captureStderr(t, func() {
+		err = convertArgs(t, "-o", filepath.Join(t.TempDir(), "out.ass"), input)
+	})
+	if err == nil {
+		t.Error("truncated download was converted")
+	}
+	if !strings.Contains(stderr, "Error: "+input+": invalid Bilibili XML") {
+		t.Errorf("stderr = %q, want the error to name the URL", stderr)
+	}
+}
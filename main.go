@@ -3,12 +3,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/m13253/danmaku2ass/ass"
 	"github.com/m13253/danmaku2ass/parser"
@@ -21,53 +27,359 @@ const (
 	DefaultSizeHeight = 240
 )
 
+// stringList 实现flag.Value接口，允许同一参数多次出现并累积取值
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // Config 存储程序运行所需的所有配置参数
 type Config struct {
-	OutputFile     string   // 输出ASS文件的路径
-	ScreenSize     string   // 视频尺寸，格式为"宽x高"
-	FontName       string   // 字幕字体名称
-	FontSize       float64  // 字幕字体大小
-	Alpha          float64  // 字幕透明度(0-1)
-	DurationMargin float64  // 弹幕持续时间边界值
-	DurationStart  float64  // 弹幕开始时间偏移
-	InputFiles     []string // 输入的弹幕文件列表
-	Width          int      // 解析后的视频宽度
-	Height         int      // 解析后的视频高度
+	ConfigFile     string           `json:"-"` // JSON配置文件路径
+	OutputFile     string           // 输出ASS文件的路径
+	Target         string           // 输出格式(ass/ssa/json)
+	Mkdir          bool             // 输出目录不存在时自动创建
+	Title          string           // ASS文件的标题，为空时使用输入文件名
+	Merge          string           // 要合并进去的已有ASS文件
+	Split          bool             // 每个输入文件单独生成一个ASS文件
+	SplitByType    bool             // 滚动、顶部和底部弹幕分别写入三个ASS文件
+	DryRun         bool             // 只统计事件数，不写入文件
+	DryValidate    bool             // 使用所有解析器分别解析输入文件并报告结果，不进行转换
+	Strict         bool             // 没有生成任何事件时视为错误，而不是只输出警告
+	WarnHours      bool             // 事件时间的小时数超过一位时输出警告
+	Verbose        bool             // 输出解析和过滤的统计信息
+	Timeout        time.Duration    // 下载URL输入的超时时间
+	ScreenSize     string           // 视频尺寸，格式为"宽x高"
+	PixelAspect    float64          // 像素宽高比
+	FontName       string           // 字幕字体名称
+	FontSize       float64          // 字幕字体大小
+	SourceWidth    int              // 弹幕尺寸参考的源视频宽度，0表示不缩放
+	FormatScale    string           // 各格式弹幕尺寸的缩放倍数，如"niconico=0.9,acfun=1.1"
+	BigScale       float64          // N站big弹幕的字体缩放倍数
+	SmallScale     float64          // N站small弹幕的字体缩放倍数
+	Fast           bool             // 使用快速扫描解析B站XML
+	Charset        string           // 输入文件的字符集，为空表示UTF-8
+	Milliseconds   string           // B站XML时间字段的单位(off/on/auto)
+	AcfunSize      string           // A站size字段的含义(auto/pixels/enum)
+	DefaultColor   string           // B站弹幕颜色缺失时使用的颜色，十六进制RRGGBB
+	Alpha          float64          // 字幕透明度(0-1)
+	ScrollAlpha    float64          // 滚动弹幕透明度，负数表示使用Alpha
+	TopAlpha       float64          // 顶部弹幕透明度，负数表示使用Alpha
+	BottomAlpha    float64          // 底部弹幕透明度，负数表示使用Alpha
+	DurationMargin float64          // 弹幕持续时间边界值
+	DurationStart  float64          // 弹幕开始时间偏移
+	Pool           int              // 只保留指定弹幕池的弹幕，-1表示全部保留
+	Block          string           // 屏蔽关键词，以逗号分隔
+	BlockRegex     []string         // 屏蔽正则表达式，可指定多个
+	User           string           // 只保留这些用户的弹幕，用户ID以逗号分隔
+	BlockUser      string           // 屏蔽这些用户的弹幕，用户ID以逗号分隔
+	KeepEmpty      bool             // 保留内容为空的弹幕
+	SkipHidden     bool             // 丢弃被标记为隐藏的弹幕
+	OnlyFixed      bool             // 只保留顶部和底部固定弹幕
+	OnlyScroll     bool             // 只保留滚动弹幕
+	Trim           bool             // 去除弹幕文本首尾的空白字符
+	KeepSlashN     string           // 不把"/n"转换为换行的格式，以逗号分隔，all表示全部格式
+	StripEmotes    bool             // 移除[doge]等表情占位符
+	NFC            bool             // 将弹幕文本转换为Unicode NFC规范形式
+	MaxLength      int              // 弹幕文本的最大字符数，0表示不限制
+	Truncate       bool             // 截断超过MaxLength的弹幕而不是丢弃
+	StartTime      float64          // 截取范围的开始时间（秒）
+	EndTime        float64          // 截取范围的结束时间（秒），0表示不限制
+	Speed          float64          // 视频播放倍速
+	Delay          float64          // 所有弹幕整体延后的时间（秒），负数表示提前
+	Reduce         float64          // 弹幕密集处随机丢弃的比例(0-1)
+	ReduceLimit    int              // 每秒允许的弹幕数量，超过时视为密集
+	ShuffleRows    bool             // 滚动弹幕随机分布在空闲行中
+	OverlapScroll  float64          // 滚动弹幕允许重叠的高度比例(0-1)
+	DimDuplicates  float64          // 重复弹幕每多出现一次不透明度乘以的系数(0-1)，0表示不降低
+	DimWindow      float64          // 统计重复弹幕的时间窗口（秒）
+	Seed           int64            // 随机数种子
+	WrapWidth      int              // 固定弹幕每行的最大宽度（像素），0表示不换行
+	WrapStyle      int              // ASS换行方式(0-3)
+	Collisions     string           // ASS碰撞处理方式(Normal/Reverse)
+	Invert         bool             // 反转弹幕颜色
+	Contrast       bool             // 过暗的弹幕颜色替换为白色
+	Palette        string           // 调色板，以逗号分隔的十六进制RRGGBB颜色
+	Outline        float64          // 字幕描边宽度
+	Shadow         float64          // 字幕阴影距离
+	Glow           string           // 光晕效果，格式为"模糊强度[,阴影距离]"
+	StylePrefix    string           // 生成的样式名前缀
+	TopAlign       int              // 顶部固定弹幕的对齐方式(1-9)
+	BottomAlign    int              // 底部固定弹幕的对齐方式(1-9)
+	FadeIn         int              // 固定弹幕淡入时长（毫秒）
+	FadeOut        int              // 固定弹幕淡出时长（毫秒）
+	FadeScroll     bool             // 滚动弹幕也使用淡入淡出
+	MaxDuration    float64          // 弹幕显示时长上限（秒），0表示不限制
+	MinDuration    float64          // 弹幕显示时长下限（秒），0表示不限制
+	FPS            float64          // 视频帧率，事件时间对齐到帧边界，0表示不对齐
+	ScrollSpeed    float64          // 滚动速度（像素/秒），0表示使用固定时长
+	FixedPos       bool             // 固定弹幕使用\pos定位
+	FixedLayer     int              // 固定弹幕的图层，滚动弹幕为0
+	UnknownPos     int              // 未知位置类型的弹幕改用的位置类型，-1表示丢弃
+	Static         bool             // 所有弹幕静止堆叠显示
+	CommentMeta    bool             // 输出记录弹幕来源的Comment行
+	EmbedFonts     []string         // 嵌入到ASS文件中的字体文件，可指定多个
+	RightToLeft    bool             // 从右到左排列阿拉伯文等弹幕
+	Vertical       bool             // 固定的中日韩弹幕逐字竖排
+	SortBy         string           // 弹幕排序方式(timeline/timestamp)
+	InputFiles     []string         `json:"-"` // 输入的弹幕文件列表
+	Width          int              `json:"-"` // 解析后的视频宽度
+	Height         int              `json:"-"` // 解析后的视频高度
+	OutputDir      string           `json:"-"` // 分别输出时的目标目录，为空表示输出到输入文件所在目录
+	DefaultRGB     int              `json:"-"` // 解析后的默认弹幕颜色
+	PaletteRGB     []int            `json:"-"` // 解析后的调色板颜色
+	GlowBlur       float64          `json:"-"` // 解析后的光晕模糊强度
+	GlowShadow     float64          `json:"-"` // 解析后的光晕阴影距离
+	TimeUnit       parser.TimeUnit  `json:"-"` // 解析后的B站XML时间单位
+	SizeMode       parser.SizeMode  `json:"-"` // 解析后的A站size字段含义
+	BlockWords     []string         `json:"-"` // 解析后的屏蔽关键词列表
+	BlockRegexps   []*regexp.Regexp `json:"-"` // 编译后的屏蔽正则表达式
+	Users          []string         `json:"-"` // 解析后的保留用户ID列表
+	BlockUsers     []string         `json:"-"` // 解析后的屏蔽用户ID列表
+	FormatScales   parser.ScaleMap  `json:"-"` // 解析后的各格式尺寸缩放倍数
+	SlashNFormats  []parser.Format  `json:"-"` // 解析后的保留"/n"的格式列表
 }
 
 // parseArgs 解析命令行参数并返回配置对象
 // 支持的参数包括：
-// -o: 输出文件路径
+// -config: JSON配置文件，命令行参数优先
+// -o: 输出文件路径（指定目录时每个输入文件分别输出）
+// -t: 输出格式
+// -mkdir: 自动创建输出目录
+// -title: ASS文件标题
+// -merge: 合并到已有的ASS文件
+// -split: 每个输入文件分别输出
+// -split-by-type: 按弹幕类型分别输出
+// -v: 输出统计信息
+// -n: 试运行，只统计事件数
+// -dry-validate: 使用所有解析器分别解析输入文件
+// -strict: 没有事件时视为错误
+// -warn-hours: 小时数超过一位时警告
+// -timeout: URL下载超时
 // -s: 屏幕尺寸(宽x高)
+// -par: 像素宽高比
 // -fn: 字体名称
 // -fs: 字体大小
+// -source-width: 弹幕尺寸参考宽度
+// -format-scale: 各格式弹幕尺寸的缩放倍数
+// -big-scale: N站big弹幕缩放倍数
+// -small-scale: N站small弹幕缩放倍数
+// -fast: 快速解析B站XML
+// -charset: 输入文件字符集
+// -ms: B站XML时间单位
+// -acfun-size: A站size字段的含义
+// -default-color: 默认弹幕颜色
 // -a: 透明度
+// -scroll-alpha/-top-alpha/-bottom-alpha: 各样式的透明度
 // -dm: 持续时间边界
 // -ds: 开始时间偏移
+// -pool: 弹幕池过滤
+// -block: 屏蔽关键词
+// -block-regex: 屏蔽正则表达式（可多次指定）
+// -user: 只保留指定用户的弹幕
+// -block-user: 屏蔽指定用户的弹幕
+// -keep-empty: 保留空白弹幕
+// -skip-hidden: 丢弃隐藏的弹幕
+// -only-fixed: 只保留固定弹幕
+// -only-scroll: 只保留滚动弹幕
+// -trim: 去除首尾空白
+// -strip-emotes: 移除表情占位符
+// -nfc: 文本转换为NFC规范形式
+// -keep-slash-n: 保留"/n"不转换为换行的格式
+// -max-length: 弹幕最大字符数
+// -truncate: 截断过长的弹幕
+// -start: 截取开始时间
+// -end: 截取结束时间
+// -speed: 播放倍速
+// -delay: 整体延后时间
+// -reduce: 密集弹幕丢弃比例
+// -reduce-limit: 密集判定阈值
+// -shuffle-rows: 随机分配滚动弹幕的行
+// -overlap-scroll: 滚动弹幕允许重叠的高度比例
+// -dim-duplicates: 重复弹幕逐渐变淡的系数
+// -dim-window: 统计重复弹幕的时间窗口
+// -seed: 随机数种子
+// -wrap-width: 固定弹幕换行宽度
+// -wrap: ASS换行方式
+// -collisions: ASS碰撞处理方式
+// -invert: 反转颜色
+// -contrast: 高对比度颜色
+// -palette: 调色板
+// -outline: 描边宽度
+// -shadow: 阴影距离
+// -glow: 光晕效果
+// -style-prefix: 样式名前缀
+// -top-align: 顶部弹幕对齐方式
+// -bottom-align: 底部弹幕对齐方式
+// -fade-in: 淡入时长
+// -fade-out: 淡出时长
+// -fade-scroll: 滚动弹幕淡入淡出
+// -max-duration: 显示时长上限
+// -min-duration: 显示时长下限
+// -fps: 对齐事件时间的视频帧率
+// -scroll-speed: 滚动速度
+// -pos: 固定弹幕使用\pos定位
+// -fixed-layer: 固定弹幕的图层
+// -unknown-position: 未知位置类型的处理方式
+// -static: 静止模式
+// -comment-meta: 输出弹幕元信息
+// -embed-font: 嵌入字体文件（可多次指定）
+// -right-to-left: 从右到左排列RTL文字
+// -vertical: 固定弹幕竖排
+// -sort: 排序方式
 func parseArgs() (*Config, error) {
 	cfg := &Config{}
 
-	flag.StringVar(&cfg.OutputFile, "o", "", "Output file path")
+	flag.StringVar(&cfg.ConfigFile, "config", "", "Load options from a JSON file keyed by Config field names; command-line flags take precedence")
+	flag.StringVar(&cfg.OutputFile, "o", "", "Output file path, or a directory to write one file per input")
+	flag.StringVar(&cfg.Target, "t", "ass", "Output format: \"ass\" subtitles, \"ssa\" legacy SSA v4 subtitles, or \"json\" to dump the parsed comments")
+	flag.BoolVar(&cfg.Mkdir, "mkdir", false, "Create the output file's directory if it does not exist")
+	flag.StringVar(&cfg.Title, "title", "", "Title written to the ASS [Script Info] section (default: the input file name)")
+	flag.StringVar(&cfg.Merge, "merge", "", "Merge the danmaku styles and events into this existing ASS file and write the combined result")
+	flag.BoolVar(&cfg.Split, "split", false, "Write one ASS file per input instead of merging all inputs")
+	flag.BoolVar(&cfg.SplitByType, "split-by-type", false, "Write scrolling, top and bottom comments to separate files (out.scroll.ass, out.top.ass, out.bottom.ass)")
+	flag.BoolVar(&cfg.Verbose, "v", false, "Print parse and filter statistics to stderr")
+	flag.BoolVar(&cfg.DryRun, "n", false, "Dry run: print how many events each style would get without writing files")
+	flag.BoolVar(&cfg.Strict, "strict", false, "Fail instead of warning when the output would contain no events")
+	flag.BoolVar(&cfg.WarnHours, "warn-hours", false, "Warn when event times exceed 9 hours and need more than one hour digit")
+	flag.BoolVar(&cfg.DryValidate, "dry-validate", false, "Run every parser on each input and report which succeed and how many comments each yields, without converting")
+	flag.DurationVar(&cfg.Timeout, "timeout", 30*time.Second, "Timeout for downloading http(s) inputs")
 	flag.StringVar(&cfg.ScreenSize, "s", fmt.Sprintf("%dx%d", DefaultSizeWidth, DefaultSizeHeight), "Screen size in the format WIDTHxHEIGHT")
+	flag.Float64Var(&cfg.PixelAspect, "par", 1, "Pixel aspect ratio of the video; the emitted Aspect Ratio is WIDTH/HEIGHT*PAR")
 	flag.StringVar(&cfg.FontName, "fn", "MS PGothic", "Font name")
 	flag.Float64Var(&cfg.FontSize, "fs", 48, "Font size")
+	flag.IntVar(&cfg.SourceWidth, "source-width", 0, "Reference width that font sizes are designed for; sizes are scaled to the output width (0 disables scaling)")
+	flag.StringVar(&cfg.FormatScale, "format-scale", "", "Per-format size multipliers applied after -fs, e.g. \"niconico=0.9,acfun=1.1\" (normal comments of every format start at -fs)")
+	flag.Float64Var(&cfg.BigScale, "big-scale", 1.5, "Font size multiplier for Niconico \"big\" comments")
+	flag.Float64Var(&cfg.SmallScale, "small-scale", 0.5, "Font size multiplier for Niconico \"small\" comments")
+	flag.BoolVar(&cfg.Fast, "fast", false, "Parse Bilibili XML with a dedicated scanner instead of the generic XML decoder (same result, faster on huge files)")
+	flag.StringVar(&cfg.Charset, "charset", "", "Character set of the input files, e.g. shift_jis or gbk (default UTF-8)")
+	flag.StringVar(&cfg.Milliseconds, "ms", "off", "Treat Bilibili XML times as milliseconds: \"off\", \"on\" or \"auto\" (times over 24 hours)")
+	flag.StringVar(&cfg.AcfunSize, "acfun-size", "auto", "Meaning of AcFun sizes: \"pixels\" (25 is normal), \"enum\" (0=small, 1=medium, 2=large) or \"auto\" (enum when all sizes are 0-2)")
+	flag.StringVar(&cfg.DefaultColor, "default-color", "FFFFFF", "Color (hex RRGGBB) used for Bilibili comments with a missing or zero color")
 	flag.Float64Var(&cfg.Alpha, "a", 0.8, "Alpha value")
+	flag.Float64Var(&cfg.ScrollAlpha, "scroll-alpha", -1, "Alpha value of the scrolling style (negative uses -a)")
+	flag.Float64Var(&cfg.TopAlpha, "top-alpha", -1, "Alpha value of the top style (negative uses -a)")
+	flag.Float64Var(&cfg.BottomAlpha, "bottom-alpha", -1, "Alpha value of the bottom style (negative uses -a)")
 	flag.Float64Var(&cfg.DurationMargin, "dm", 5, "Duration margin")
 	flag.Float64Var(&cfg.DurationStart, "ds", 5, "Duration start")
+	flag.IntVar(&cfg.Pool, "pool", -1, "Only keep comments from this Bilibili pool (0=normal, 1=subtitle, 2=special, -1=all)")
+	flag.StringVar(&cfg.Block, "block", "", "Comma-separated keywords; comments containing any of them are dropped (case-insensitive)")
+	flag.Var((*stringList)(&cfg.BlockRegex), "block-regex", "Drop comments matching this regular expression (may be repeated)")
+	flag.StringVar(&cfg.User, "user", "", "Comma-separated user IDs; only comments sent by them are kept (Niconico user_id, Bilibili sender hash)")
+	flag.StringVar(&cfg.BlockUser, "block-user", "", "Comma-separated user IDs whose comments are dropped")
+	flag.BoolVar(&cfg.KeepEmpty, "keep-empty", false, "Keep comments whose text is empty or whitespace-only")
+	flag.BoolVar(&cfg.SkipHidden, "skip-hidden", false, "Drop Bilibili comments marked hidden=\"1\" (reported or blocked)")
+	flag.BoolVar(&cfg.OnlyFixed, "only-fixed", false, "Drop scrolling comments and keep only top and bottom comments")
+	flag.BoolVar(&cfg.OnlyScroll, "only-scroll", false, "Drop top and bottom comments and keep only scrolling comments")
+	flag.BoolVar(&cfg.Trim, "trim", false, "Strip leading and trailing whitespace from comment text")
+	flag.BoolVar(&cfg.StripEmotes, "strip-emotes", false, "Remove emote placeholders such as [doge] from comment text")
+	flag.BoolVar(&cfg.NFC, "nfc", true, "Normalize comment text to Unicode NFC; use -nfc=false to keep text as written")
+	flag.StringVar(&cfg.KeepSlashN, "keep-slash-n", "", "Comma-separated formats (or \"all\") whose literal \"/n\" is kept as text instead of becoming a line break")
+	flag.IntVar(&cfg.MaxLength, "max-length", 0, "Drop comments longer than this many characters (0 disables)")
+	flag.BoolVar(&cfg.Truncate, "truncate", false, "Truncate comments longer than -max-length with an ellipsis instead of dropping them")
+	flag.Float64Var(&cfg.StartTime, "start", 0, "Only convert comments from this time (seconds); output is shifted to start at zero")
+	flag.Float64Var(&cfg.EndTime, "end", 0, "Only convert comments before this time (seconds, 0 means no limit)")
+	flag.Float64Var(&cfg.Speed, "speed", 1, "Playback speed factor applied to all timelines (2 halves all timestamps)")
+	flag.Float64Var(&cfg.Delay, "delay", 0, "Seconds added to every comment's time after -start and -speed (negative shows them earlier; comments moved before zero are dropped)")
+	flag.Float64Var(&cfg.Reduce, "reduce", 0, "Fraction (0-1) of comments to randomly drop where danmaku are dense")
+	flag.IntVar(&cfg.ReduceLimit, "reduce-limit", 10, "Comments per second above which -reduce starts dropping")
+	flag.BoolVar(&cfg.ShuffleRows, "shuffle-rows", false, "Place scrolling comments on random free rows instead of the topmost one (seeded by -seed)")
+	flag.Float64Var(&cfg.OverlapScroll, "overlap-scroll", 0, "Fraction (0-1) of a scrolling comment's height allowed to overlap the row below, packing busy streams tighter")
+	flag.Float64Var(&cfg.DimDuplicates, "dim-duplicates", 0, "Keep repeated comments but multiply their opacity by this factor (0-1) for every earlier copy within -dim-window (0 disables)")
+	flag.Float64Var(&cfg.DimWindow, "dim-window", 10, "Time window in seconds in which identical comments count as repeats for -dim-duplicates")
+	flag.Int64Var(&cfg.Seed, "seed", 0, "Random seed shared by -reduce and -shuffle-rows; the same seed always gives the same output")
+	flag.IntVar(&cfg.WrapWidth, "wrap-width", 0, "Break top and bottom comments wider than this many pixels into several lines (0 disables)")
+	flag.IntVar(&cfg.WrapStyle, "wrap", 2, "ASS WrapStyle (0-3)")
+	flag.StringVar(&cfg.Collisions, "collisions", "Normal", "ASS Collisions mode (Normal or Reverse)")
+	flag.BoolVar(&cfg.Invert, "invert", false, "Invert all comment and outline colors for mostly white video")
+	flag.BoolVar(&cfg.Contrast, "contrast", false, "Replace dark comment colors with white so they contrast with the black outline")
+	flag.StringVar(&cfg.Palette, "palette", "", "Comma-separated hex RRGGBB colors; every comment color is replaced by the nearest one")
+	flag.Float64Var(&cfg.Outline, "outline", 2, "Outline width")
+	flag.Float64Var(&cfg.Shadow, "shadow", 0, "Shadow depth")
+	flag.StringVar(&cfg.Glow, "glow", "", "Soft glow on every event as \"BLUR[,SHADOW]\", emitted as \\blur and \\shad tags, e.g. \"3,1\"")
+	flag.StringVar(&cfg.StylePrefix, "style-prefix", "", "Prefix added to the generated style names R2L, Top and Bottom")
+	flag.IntVar(&cfg.TopAlign, "top-align", 8, "ASS alignment (1-9, numpad layout) of top comments")
+	flag.IntVar(&cfg.BottomAlign, "bottom-align", 2, "ASS alignment (1-9, numpad layout) of bottom comments")
+	flag.IntVar(&cfg.FadeIn, "fade-in", 0, "Fade-in duration of fixed comments in milliseconds")
+	flag.IntVar(&cfg.FadeOut, "fade-out", 0, "Fade-out duration of fixed comments in milliseconds")
+	flag.BoolVar(&cfg.FadeScroll, "fade-scroll", false, "Also apply -fade-in/-fade-out to scrolling comments")
+	flag.BoolVar(&cfg.FixedPos, "pos", false, "Position stacked top and bottom comments with \\pos instead of MarginV")
+	flag.IntVar(&cfg.FixedLayer, "fixed-layer", 1, "ASS Layer of top and bottom comments; scrolling comments use layer 0, so higher layers render on top")
+	flag.IntVar(&cfg.UnknownPos, "unknown-position", -1, "Position used for comments with an unknown position type: 0=scroll, 1=top, 2=bottom, 3=left-to-right scroll (-1 drops them)")
+	flag.BoolVar(&cfg.Static, "static", false, "Render all comments as stacked static lines instead of scrolling")
+	flag.BoolVar(&cfg.CommentMeta, "comment-meta", false, "Write each comment's number and send timestamp as an ASS Comment line before its event")
+	flag.Var((*stringList)(&cfg.EmbedFonts), "embed-font", "Embed this font file in the [Fonts] section of the output (may be repeated)")
+	flag.BoolVar(&cfg.RightToLeft, "right-to-left", false, "Lay out Arabic, Hebrew and other right-to-left comments with a right-to-left base direction")
+	flag.BoolVar(&cfg.Vertical, "vertical", false, "Stack the characters of top and bottom CJK comments vertically, one per line")
+	flag.StringVar(&cfg.SortBy, "sort", "timeline", "Order events by \"timeline\" or by send \"timestamp\"")
+	flag.Float64Var(&cfg.MaxDuration, "max-duration", 0, "Maximum event duration in seconds; longer scrolling comments move faster (0 means no limit)")
+	flag.Float64Var(&cfg.MinDuration, "min-duration", 0, "Minimum event duration in seconds so comments stay readable; shorter scrolling comments move slower (0 means no limit)")
+	flag.Float64Var(&cfg.FPS, "fps", 0, "Video frame rate, e.g. 23.976; event times are snapped to frame boundaries (0 disables)")
+	flag.Float64Var(&cfg.ScrollSpeed, "scroll-speed", 0, "Scrolling speed in pixels per second; scroll duration then depends on text width (0 uses a fixed duration)")
 
 	flag.Parse()
 
+	// Load the config file over the defaults, then put back the flags given
+	// on the command line so that they override values from the file
+	if cfg.ConfigFile != "" {
+		cli := *cfg
+		// Decoding reuses the backing arrays of existing slices, which are
+		// shared with the copy above
+		cfg.BlockRegex = nil
+		cfg.EmbedFonts = nil
+		if err := decodeConfigFile(cfg.ConfigFile, cfg); err != nil {
+			return nil, err
+		}
+		restoreFlags(cfg, &cli)
+	}
+
 	// Get input files from remaining arguments
-	cfg.InputFiles = flag.Args()
-	if len(cfg.InputFiles) == 0 {
+	if flag.NArg() == 0 {
 		return nil, fmt.Errorf("no input files specified")
 	}
+	inputFiles, err := expandInputs(flag.Args())
+	if err != nil {
+		return nil, err
+	}
+	if len(inputFiles) == 0 {
+		return nil, fmt.Errorf("no danmaku files found in %s", strings.Join(flag.Args(), " "))
+	}
+	cfg.InputFiles = inputFiles
+
+	// Validate output format
+	if cfg.Target != "ass" && cfg.Target != "ssa" && cfg.Target != "json" {
+		return nil, fmt.Errorf("invalid output format: %s", cfg.Target)
+	}
+	if cfg.Target != "ass" && cfg.Merge != "" {
+		return nil, fmt.Errorf("-merge requires ASS output")
+	}
+	if cfg.SplitByType && cfg.Target == "json" {
+		return nil, fmt.Errorf("-split-by-type requires ASS or SSA output")
+	}
+	if cfg.SplitByType && cfg.Merge != "" {
+		return nil, fmt.Errorf("-split-by-type and -merge cannot be used together")
+	}
 
-	// If output file is not specified, use the first input file name with .ass extension
-	if cfg.OutputFile == "" {
-		base := filepath.Base(cfg.InputFiles[0])
-		ext := filepath.Ext(base)
-		cfg.OutputFile = base[:len(base)-len(ext)] + ".ass"
+	// If output names a directory, write one file per input into it
+	if cfg.OutputFile != "" {
+		if info, err := os.Stat(cfg.OutputFile); err == nil && info.IsDir() {
+			cfg.Split = true
+			cfg.OutputDir = cfg.OutputFile
+		} else if cfg.Split {
+			return nil, fmt.Errorf("output %s is not a directory; -split writes one file per input", cfg.OutputFile)
+		}
+	}
+
+	// If output file is not specified, use the first input file name with the output format's extension
+	if cfg.OutputFile == "" && !cfg.Split {
+		cfg.OutputFile = trimExt(inputBase(cfg.InputFiles[0])) + "." + cfg.Target
 	}
 
 	// Parse screen size
@@ -86,18 +398,359 @@ func parseArgs() (*Config, error) {
 		return nil, fmt.Errorf("invalid screen height: %s", parts[1])
 	}
 
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid screen size %s: width and height must be positive", cfg.ScreenSize)
+	}
+
 	cfg.Width = width
 	cfg.Height = height
 
+	if cfg.PixelAspect <= 0 {
+		return nil, fmt.Errorf("invalid pixel aspect ratio: %v", cfg.PixelAspect)
+	}
+
+	// Validate pool filter
+	if cfg.Pool < -1 || cfg.Pool > 2 {
+		return nil, fmt.Errorf("invalid pool: %d", cfg.Pool)
+	}
+
+	// Validate time range
+	if cfg.StartTime < 0 {
+		return nil, fmt.Errorf("invalid start time: %g", cfg.StartTime)
+	}
+	if cfg.EndTime < 0 || (cfg.EndTime > 0 && cfg.EndTime <= cfg.StartTime) {
+		return nil, fmt.Errorf("invalid end time: %g", cfg.EndTime)
+	}
+
+	// Validate source reference width
+	if cfg.SourceWidth < 0 {
+		return nil, fmt.Errorf("invalid source width: %d", cfg.SourceWidth)
+	}
+
+	// Parse per-format size multipliers
+	if cfg.FormatScale != "" {
+		cfg.FormatScales = make(parser.ScaleMap)
+		for _, item := range strings.Split(cfg.FormatScale, ",") {
+			name, value, ok := strings.Cut(item, "=")
+			format, known := parser.LookupFormat(strings.TrimSpace(name))
+			scale, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if !ok || !known || err != nil || scale <= 0 {
+				return nil, fmt.Errorf("invalid format scale: %s", item)
+			}
+			cfg.FormatScales[format] = scale
+		}
+	}
+
+	// Parse the formats that keep "/n" as text
+	if cfg.KeepSlashN == "all" {
+		cfg.SlashNFormats = parser.Formats()
+	} else if cfg.KeepSlashN != "" {
+		for _, name := range strings.Split(cfg.KeepSlashN, ",") {
+			format, ok := parser.LookupFormat(strings.TrimSpace(name))
+			if !ok {
+				return nil, fmt.Errorf("invalid keep-slash-n format: %s", name)
+			}
+			cfg.SlashNFormats = append(cfg.SlashNFormats, format)
+		}
+	}
+
+	// Validate font size multipliers
+	if cfg.BigScale <= 0 {
+		return nil, fmt.Errorf("invalid big scale: %g", cfg.BigScale)
+	}
+	if cfg.SmallScale <= 0 {
+		return nil, fmt.Errorf("invalid small scale: %g", cfg.SmallScale)
+	}
+
+	// Parse default color
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(cfg.DefaultColor, "#"), 16, 32)
+	if err != nil || rgb > 0xFFFFFF {
+		return nil, fmt.Errorf("invalid default color: %s", cfg.DefaultColor)
+	}
+	cfg.DefaultRGB = int(rgb)
+
+	// Parse palette colors
+	if cfg.Palette != "" {
+		for _, s := range strings.Split(cfg.Palette, ",") {
+			s = strings.TrimSpace(s)
+			rgb, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+			if err != nil || rgb > 0xFFFFFF {
+				return nil, fmt.Errorf("invalid palette color: %s", s)
+			}
+			cfg.PaletteRGB = append(cfg.PaletteRGB, int(rgb))
+		}
+	}
+
+	if err := parser.CheckCharset(cfg.Charset); err != nil {
+		return nil, err
+	}
+
+	// Parse Bilibili time unit
+	timeUnits := map[string]parser.TimeUnit{
+		"off":  parser.TimeUnitSeconds,
+		"on":   parser.TimeUnitMilliseconds,
+		"auto": parser.TimeUnitAuto,
+	}
+	unit, ok := timeUnits[cfg.Milliseconds]
+	if !ok {
+		return nil, fmt.Errorf("invalid millisecond mode: %s", cfg.Milliseconds)
+	}
+	cfg.TimeUnit = unit
+
+	// Parse AcFun size mode
+	sizeModes := map[string]parser.SizeMode{
+		"pixels": parser.SizePixels,
+		"enum":   parser.SizeEnum,
+		"auto":   parser.SizeAuto,
+	}
+	sizeMode, ok := sizeModes[cfg.AcfunSize]
+	if !ok {
+		return nil, fmt.Errorf("invalid AcFun size mode: %s", cfg.AcfunSize)
+	}
+	cfg.SizeMode = sizeMode
+
+	// Validate download timeout
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout: %v", cfg.Timeout)
+	}
+
+	// Validate playback speed
+	if cfg.Speed <= 0 {
+		return nil, fmt.Errorf("invalid speed: %g", cfg.Speed)
+	}
+
+	// Validate density reduction
+	if cfg.OverlapScroll < 0 || cfg.OverlapScroll >= 1 {
+		return nil, fmt.Errorf("invalid scroll overlap: %g", cfg.OverlapScroll)
+	}
+	if cfg.DimDuplicates < 0 || cfg.DimDuplicates >= 1 {
+		return nil, fmt.Errorf("invalid dim factor: %g", cfg.DimDuplicates)
+	}
+	if cfg.DimDuplicates > 0 && cfg.Target == "ssa" {
+		return nil, fmt.Errorf("-dim-duplicates requires ASS output; SSA has no \\alpha tag")
+	}
+	if cfg.DimWindow <= 0 {
+		return nil, fmt.Errorf("invalid dim window: %g", cfg.DimWindow)
+	}
+	if cfg.Reduce < 0 || cfg.Reduce > 1 {
+		return nil, fmt.Errorf("invalid reduce ratio: %g", cfg.Reduce)
+	}
+	if cfg.ReduceLimit < 0 {
+		return nil, fmt.Errorf("invalid reduce limit: %d", cfg.ReduceLimit)
+	}
+
+	// Validate ASS header options
+	if cfg.WrapStyle < 0 || cfg.WrapStyle > 3 {
+		return nil, fmt.Errorf("invalid wrap style: %d", cfg.WrapStyle)
+	}
+	if cfg.Collisions != "Normal" && cfg.Collisions != "Reverse" {
+		return nil, fmt.Errorf("invalid collisions mode: %s", cfg.Collisions)
+	}
+	if cfg.Outline < 0 {
+		return nil, fmt.Errorf("invalid outline width: %g", cfg.Outline)
+	}
+	if cfg.Shadow < 0 {
+		return nil, fmt.Errorf("invalid shadow depth: %g", cfg.Shadow)
+	}
+
+	// Parse glow as BLUR[,SHADOW]
+	if cfg.Glow != "" {
+		if cfg.Target == "ssa" {
+			return nil, fmt.Errorf("-glow requires ASS output; SSA has no \\blur or \\shad tags")
+		}
+		blur, shadow, _ := strings.Cut(cfg.Glow, ",")
+		var err error
+		if cfg.GlowBlur, err = strconv.ParseFloat(strings.TrimSpace(blur), 64); err != nil || cfg.GlowBlur <= 0 {
+			return nil, fmt.Errorf("invalid glow: %s", cfg.Glow)
+		}
+		if shadow != "" {
+			if cfg.GlowShadow, err = strconv.ParseFloat(strings.TrimSpace(shadow), 64); err != nil || cfg.GlowShadow < 0 {
+				return nil, fmt.Errorf("invalid glow: %s", cfg.Glow)
+			}
+		}
+	}
+	if cfg.TopAlign < 1 || cfg.TopAlign > 9 {
+		return nil, fmt.Errorf("invalid top alignment: %d", cfg.TopAlign)
+	}
+	if cfg.BottomAlign < 1 || cfg.BottomAlign > 9 {
+		return nil, fmt.Errorf("invalid bottom alignment: %d", cfg.BottomAlign)
+	}
+	if cfg.FadeIn < 0 || cfg.FadeOut < 0 {
+		return nil, fmt.Errorf("invalid fade duration: %d,%d", cfg.FadeIn, cfg.FadeOut)
+	}
+	if (cfg.FadeIn > 0 || cfg.FadeOut > 0) && cfg.Target == "ssa" {
+		return nil, fmt.Errorf("-fade-in and -fade-out require ASS output; SSA has no \\fad tag")
+	}
+	if cfg.SortBy != string(ass.SortByTimeline) && cfg.SortBy != string(ass.SortByTimestamp) {
+		return nil, fmt.Errorf("invalid sort order: %s", cfg.SortBy)
+	}
+	if strings.ContainsAny(cfg.StylePrefix, ",\r\n") {
+		return nil, fmt.Errorf("invalid style prefix: %q", cfg.StylePrefix)
+	}
+	if cfg.ScrollAlpha > 1 {
+		return nil, fmt.Errorf("invalid scroll alpha: %g", cfg.ScrollAlpha)
+	}
+	if cfg.TopAlpha > 1 {
+		return nil, fmt.Errorf("invalid top alpha: %g", cfg.TopAlpha)
+	}
+	if cfg.BottomAlpha > 1 {
+		return nil, fmt.Errorf("invalid bottom alpha: %g", cfg.BottomAlpha)
+	}
+	if cfg.FixedLayer < 0 {
+		return nil, fmt.Errorf("invalid fixed layer: %d", cfg.FixedLayer)
+	}
+	if cfg.UnknownPos < -1 || cfg.UnknownPos > 3 {
+		return nil, fmt.Errorf("invalid unknown position: %d", cfg.UnknownPos)
+	}
+	if cfg.Invert && cfg.Contrast {
+		return nil, fmt.Errorf("-invert and -contrast cannot be used together")
+	}
+	if cfg.OnlyFixed && cfg.OnlyScroll {
+		return nil, fmt.Errorf("-only-fixed and -only-scroll cannot be used together")
+	}
+	if cfg.MaxLength < 0 {
+		return nil, fmt.Errorf("invalid max length: %d", cfg.MaxLength)
+	}
+	if cfg.Truncate && cfg.MaxLength == 0 {
+		return nil, fmt.Errorf("-truncate requires -max-length")
+	}
+	if cfg.WrapWidth < 0 {
+		return nil, fmt.Errorf("invalid wrap width: %d", cfg.WrapWidth)
+	}
+	if cfg.MaxDuration < 0 {
+		return nil, fmt.Errorf("invalid max duration: %g", cfg.MaxDuration)
+	}
+	if cfg.MinDuration < 0 {
+		return nil, fmt.Errorf("invalid min duration: %g", cfg.MinDuration)
+	}
+	if cfg.MaxDuration > 0 && cfg.MinDuration > cfg.MaxDuration {
+		return nil, fmt.Errorf("min duration %g exceeds max duration %g", cfg.MinDuration, cfg.MaxDuration)
+	}
+	if cfg.FPS < 0 {
+		return nil, fmt.Errorf("invalid fps: %g", cfg.FPS)
+	}
+	if cfg.ScrollSpeed < 0 {
+		return nil, fmt.Errorf("invalid scroll speed: %g", cfg.ScrollSpeed)
+	}
+
+	// Parse blocked keywords
+	if cfg.Block != "" {
+		cfg.BlockWords = strings.Split(cfg.Block, ",")
+	}
+
+	// Parse user filters
+	if cfg.User != "" {
+		cfg.Users = strings.Split(cfg.User, ",")
+	}
+	if cfg.BlockUser != "" {
+		cfg.BlockUsers = strings.Split(cfg.BlockUser, ",")
+	}
+
+	// Compile blocked regular expressions
+	for _, pattern := range cfg.BlockRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block regex %q: %v", pattern, err)
+		}
+		cfg.BlockRegexps = append(cfg.BlockRegexps, re)
+	}
+
+	// Check embedded fonts before converting anything
+	for _, font := range cfg.EmbedFonts {
+		if info, err := os.Stat(font); err != nil {
+			return nil, fmt.Errorf("invalid embedded font: %v", err)
+		} else if info.IsDir() {
+			return nil, fmt.Errorf("invalid embedded font: %s is a directory", font)
+		}
+	}
+
 	return cfg, nil
 }
 
+// danmakuExts 展开目录和通配符时识别为弹幕文件的扩展名
+var danmakuExts = map[string]bool{
+	".xml":  true,
+	".json": true,
+	".csv":  true,
+	".zip":  true,
+	".gz":   true,
+}
+
+// expandInputs 展开命令行中的输入参数
+// 支持以下几种形式：
+// 1. 普通文件路径和http(s)地址：原样保留
+// 2. 目录：递归查找其中的弹幕文件
+// 3. 通配符(如*.xml)：使用filepath.Glob展开，跳过目录和非弹幕文件；
+//    只有路径不存在时才按通配符处理，文件名本身含有[]等字符的文件（如"ep [1080p].xml"）原样保留
+//
+// 参数：
+//   - args: 命令行中的输入参数
+//
+// 返回值：
+//   - []string: 展开后的输入文件列表
+//   - error: 通配符格式错误或目录无法遍历时返回错误
+func expandInputs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		// URL：原样保留，转换时再下载
+		if isURL(arg) {
+			files = append(files, arg)
+			continue
+		}
+
+		info, statErr := os.Stat(arg)
+
+		// 已存在的文件：原样保留，即使文件名中含有通配符字符
+		if statErr == nil && !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		// 目录：递归查找弹幕文件
+		if statErr == nil {
+			err := filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && danmakuExts[strings.ToLower(filepath.Ext(path))] {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error reading directory %s: %v", arg, err)
+			}
+			continue
+		}
+
+		// 通配符：路径不存在时展开匹配的弹幕文件
+		if errors.Is(statErr, fs.ErrNotExist) && strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", arg, err)
+			}
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err != nil || info.IsDir() || !danmakuExts[strings.ToLower(filepath.Ext(match))] {
+					continue
+				}
+				files = append(files, match)
+			}
+			continue
+		}
+
+		files = append(files, arg)
+	}
+
+	return files, nil
+}
+
 // main 程序入口函数
 // 主要流程：
 // 1. 解析命令行参数
 // 2. 创建ASS生成器
-// 3. 处理所有输入文件
-// 4. 生成最终的ASS文件
+// 3. 按输出文件划分转换任务
+// 4. 处理输入文件并生成ASS文件
 func main() {
 	cfg, err := parseArgs()
 	if err != nil {
@@ -106,49 +759,103 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create ASS generator
-	generator := ass.NewGenerator(
-		cfg.Width,
-		cfg.Height,
-		cfg.FontName,
-		cfg.FontSize,
-		cfg.Alpha,
-		cfg.DurationStart,
-		cfg.DurationMargin,
-	)
+	generator := newGenerator(cfg)
+	parseOpts := newParseOptions(cfg)
 
-	// Process all input files
-	var allComments []parser.Comment
-	for _, inputFile := range cfg.InputFiles {
-		file, err := os.Open(inputFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", inputFile, err)
-			continue
-		}
-		defer file.Close()
+	// Cancel the conversion on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-		// Detect format
-		format, err := parser.ProbeFormat(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error detecting format of %s: %v\n", inputFile, err)
-			continue
+	// Report how every parser handles the inputs instead of converting
+	if cfg.DryValidate {
+		if !validateInputs(ctx, cfg, parseOpts) {
+			os.Exit(1)
 		}
+		return
+	}
 
-		// Parse comments
-		comments, err := parser.ParseComments(file, format, cfg.FontSize)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", inputFile, err)
+	// Build conversion jobs and run them
+	failed := false
+	for _, j := range buildJobs(cfg) {
+		if err := convert(ctx, cfg, generator, parseOpts, j); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating ASS file %s: %v\n", j.output, err)
+			failed = true
 			continue
 		}
-
-		allComments = append(allComments, comments...)
+		if !cfg.DryRun {
+			fmt.Printf("Successfully converted to %s\n", j.output)
+		}
 	}
 
-	// Generate ASS file
-	if err := generator.GenerateASS(allComments, cfg.OutputFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating ASS file: %v\n", err)
+	if failed {
 		os.Exit(1)
 	}
+}
+
+// newGenerator 按配置创建ASS生成器
+func newGenerator(cfg *Config) *ass.Generator {
+	generator := ass.NewGenerator(
+		cfg.Width,
+		cfg.Height,
+		cfg.FontName,
+		cfg.FontSize,
+		cfg.Alpha,
+		cfg.DurationStart,
+		cfg.DurationMargin,
+	)
+	generator.WrapStyle = cfg.WrapStyle
+	generator.Collisions = cfg.Collisions
+	generator.Outline = cfg.Outline
+	generator.Shadow = cfg.Shadow
+	generator.Blur = cfg.GlowBlur
+	generator.GlowShadow = cfg.GlowShadow
+	generator.TopAlign = cfg.TopAlign
+	generator.BottomAlign = cfg.BottomAlign
+	generator.FadeIn = cfg.FadeIn
+	generator.FadeOut = cfg.FadeOut
+	generator.FadeScroll = cfg.FadeScroll
+	generator.ScrollSpeed = cfg.ScrollSpeed
+	generator.MaxDuration = cfg.MaxDuration
+	generator.MinDuration = cfg.MinDuration
+	generator.SSA = cfg.Target == "ssa"
+	generator.FPS = cfg.FPS
+	generator.ShuffleRows = cfg.ShuffleRows
+	generator.Overlap = cfg.OverlapScroll
+	generator.DimDecay = cfg.DimDuplicates
+	generator.DimWindow = cfg.DimWindow
+	generator.Seed = cfg.Seed
+	generator.Static = cfg.Static
+	generator.FixedPos = cfg.FixedPos
+	generator.Invert = cfg.Invert
+	generator.Contrast = cfg.Contrast
+	generator.Palette = cfg.PaletteRGB
+	generator.StylePrefix = cfg.StylePrefix
+	generator.ScrollAlpha = cfg.ScrollAlpha
+	generator.TopAlpha = cfg.TopAlpha
+	generator.BottomAlpha = cfg.BottomAlpha
+	generator.UnknownPos = cfg.UnknownPos
+	generator.FixedLayer = cfg.FixedLayer
+	generator.CommentMeta = cfg.CommentMeta
+	generator.EmbedFonts = cfg.EmbedFonts
+	generator.SortBy = ass.SortOrder(cfg.SortBy)
+	generator.PixelAspect = cfg.PixelAspect
+	generator.RightToLeft = cfg.RightToLeft
+	generator.Vertical = cfg.Vertical
+	return generator
+}
 
-	fmt.Printf("Successfully converted to %s\n", cfg.OutputFile)
+// newParseOptions 按配置创建弹幕解析选项
+func newParseOptions(cfg *Config) parser.Options {
+	parseOpts := parser.DefaultOptions(cfg.FontSize)
+	parseOpts.BigScale = cfg.BigScale
+	parseOpts.SmallScale = cfg.SmallScale
+	parseOpts.DefaultColor = cfg.DefaultRGB
+	parseOpts.TimeUnit = cfg.TimeUnit
+	parseOpts.AcfunSize = cfg.SizeMode
+	parseOpts.FormatScale = cfg.FormatScales
+	parseOpts.Charset = cfg.Charset
+	parseOpts.Fast = cfg.Fast
+	parseOpts.Trim = cfg.Trim
+	parseOpts.KeepSlashN = cfg.SlashNFormats
+	return parseOpts
 }
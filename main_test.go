@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseTestArgs 以args作为命令行参数调用parseArgs
+// 每次使用新的FlagSet，参数解析错误不会退出测试进程
+func parseTestArgs(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	oldArgs, oldFlags := os.Args, flag.CommandLine
+	t.Cleanup(func() {
+		os.Args, flag.CommandLine = oldArgs, oldFlags
+	})
+
+	os.Args = append([]string{"danmaku2ass"}, args...)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	return parseArgs()
+}
+
+// convertArgs 以args作为命令行参数执行全部转换任务，返回第一个失败任务的错误
+func convertArgs(t *testing.T, args ...string) error {
+	t.Helper()
+	cfg, err := parseTestArgs(t, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := newGenerator(cfg)
+	opts := newParseOptions(cfg)
+	for _, j := range buildJobs(cfg) {
+		if err := convert(context.Background(), cfg, generator, opts, j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestParseArgsScreenSize(t *testing.T) {
+	for _, size := range []string{"0x1080", "1920x0", "-1920x1080", "1920x-1", "1920", "axb"} {
+		if _, err := parseTestArgs(t, "-s", size, "test/bilibili_pools.xml"); err == nil {
+			t.Errorf("-s %s was accepted", size)
+		}
+	}
+
+	cfg, err := parseTestArgs(t, "-s", "1920x1080", "test/bilibili_pools.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 1920 || cfg.Height != 1080 {
+		t.Errorf("size = %dx%d, want 1920x1080", cfg.Width, cfg.Height)
+	}
+}
+
+// touch 创建空文件
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpandInputsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.xml", "b.JSON", "sub/c.xml", "notes.txt"} {
+		touch(t, filepath.Join(dir, name))
+	}
+
+	files, err := expandInputs([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.xml"), filepath.Join(dir, "b.JSON"), filepath.Join(dir, "sub", "c.xml")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+}
+
+func TestExpandInputsGlob(t *testing.T) {
+	dir := t.TempDir()
+	bracketed := filepath.Join(dir, "ep [1080p].xml")
+	for _, path := range []string{bracketed, filepath.Join(dir, "ep1.xml"), filepath.Join(dir, "ep2.xml")} {
+		touch(t, path)
+	}
+
+	// 已存在的文件不按通配符展开，即使文件名中含有[]
+	files, err := expandInputs([]string{bracketed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{bracketed}) {
+		t.Errorf("files = %q, want %q", files, []string{bracketed})
+	}
+
+	files, err = expandInputs([]string{filepath.Join(dir, "ep?.xml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("ep?.xml matched %q, want ep1.xml and ep2.xml", files)
+	}
+}
+
+func TestParseArgsSSAOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"-fade-in", "200"},
+		{"-fade-out", "200"},
+		{"-glow", "3"},
+		{"-dim-duplicates", "0.5"},
+	} {
+		if _, err := parseTestArgs(t, append(append([]string{"-t", "ssa"}, args...), "test/bilibili_pools.xml")...); err == nil {
+			t.Errorf("-t ssa %s was accepted", strings.Join(args, " "))
+		}
+	}
+	if _, err := parseTestArgs(t, "-t", "ssa", "-fixed-pos", "test/bilibili_pools.xml"); err != nil {
+		t.Errorf("-t ssa -fixed-pos: %v", err)
+	}
+}
+
+func TestParseArgsPalette(t *testing.T) {
+	cfg, err := parseTestArgs(t, "-palette", "FFFFFF, #e69f00,56B4E9", "test/bilibili_pools.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0xFFFFFF, 0xE69F00, 0x56B4E9}; !reflect.DeepEqual(cfg.PaletteRGB, want) {
+		t.Errorf("palette = %06X, want %06X", cfg.PaletteRGB, want)
+	}
+	for _, palette := range []string{"GG0000", "1000000", "FFFFFF,"} {
+		if _, err := parseTestArgs(t, "-palette", palette, "test/bilibili_pools.xml"); err == nil {
+			t.Errorf("-palette %q was accepted", palette)
+		}
+	}
+}
+
+func TestParseArgsGlow(t *testing.T) {
+	for _, tc := range []struct {
+		glow         string
+		blur, shadow float64
+	}{
+		{"3", 3, 0},
+		{"3,1", 3, 1},
+		{" 2.5 , 0.5 ", 2.5, 0.5},
+	} {
+		cfg, err := parseTestArgs(t, "-glow", tc.glow, "test/bilibili_pools.xml")
+		if err != nil {
+			t.Fatalf("-glow %q: %v", tc.glow, err)
+		}
+		if cfg.GlowBlur != tc.blur || cfg.GlowShadow != tc.shadow {
+			t.Errorf("-glow %q = %v,%v, want %v,%v", tc.glow, cfg.GlowBlur, cfg.GlowShadow, tc.blur, tc.shadow)
+		}
+	}
+	for _, glow := range []string{"0", "-1", "3,-1", "a", "3,b"} {
+		if _, err := parseTestArgs(t, "-glow", glow, "test/bilibili_pools.xml"); err == nil {
+			t.Errorf("-glow %q was accepted", glow)
+		}
+	}
+}
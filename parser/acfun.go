@@ -2,8 +2,10 @@
 package parser
 
 import (
-	"encoding/json"
-	"os"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -16,29 +18,142 @@ import (
 //   "color": 16777215,// 颜色值（十进制RGB）
 //   "content": "text" // 弹幕内容
 // }
+// 部分旧版导出文件则把属性放在逗号分隔的c字段中，内容放在m字段中：
+// {"c": "时间,颜色,模式,字体大小,用户ID,时间戳,弹幕ID", "m": "弹幕内容"}
+// 更早的导出文件只有前5个字段（时间,颜色,模式,字体大小,用户ID），没有时间戳
+// 字段顺序与B站的c字段（时间,模式,字体大小,颜色,...）不同
 type AcfunComment struct {
-	Time    float64 `json:"time"`    // 弹幕出现时间（秒）
-	Mode    int     `json:"mode"`    // 弹幕模式（1=滚动，4=底部，5=顶部，6=逆向）
-	Size    int     `json:"size"`    // 字体大小（25为标准大小）
-	Color   int     `json:"color"`   // 字体颜色（十进制RGB值）
-	Content string  `json:"content"` // 弹幕文本内容
+	Time      float64 `json:"time"`    // 弹幕出现时间（秒）
+	Mode      int     `json:"mode"`    // 弹幕模式（1=滚动，4=底部，5=顶部，6=逆向）
+	Size      int     `json:"size"`    // 字体大小（25为标准大小），部分导出工具为0-2的枚举值
+	Color     int     `json:"color"`   // 字体颜色（十进制RGB值），部分导出工具带有Alpha通道(0xAARRGGBB)
+	Content   string  `json:"content"` // 弹幕文本内容
+	C         string  `json:"c"`       // 逗号分隔的弹幕属性（c字段形式）
+	M         string  `json:"m"`       // 弹幕文本内容（与c搭配使用）
+	UserID    string  `json:"-"`       // 从c字段中解析出的用户ID
+	Timestamp int64   `json:"-"`       // 从c字段中解析出的发送时间戳
 }
+
+// parseAcfunC 解析c字段形式的A站弹幕，将属性和内容填入对象形式的字段
+// 格式：时间,颜色,模式,字体大小[,用户ID[,时间戳[,弹幕ID]]]，任意已有字段无法解析时返回false
+func parseAcfunC(c *AcfunComment) bool {
+	fields := strings.Split(c.C, ",")
+	if len(fields) < 4 {
+		return false
+	}
+
+	var err error
+	if c.Time, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return false
+	}
+	if c.Color, err = strconv.Atoi(fields[1]); err != nil {
+		return false
+	}
+	if c.Mode, err = strconv.Atoi(fields[2]); err != nil {
+		return false
+	}
+	if c.Size, err = strconv.Atoi(fields[3]); err != nil {
+		return false
+	}
+	if len(fields) > 4 {
+		c.UserID = fields[4]
+	}
+	if len(fields) > 5 {
+		if c.Timestamp, err = strconv.ParseInt(fields[5], 10, 64); err != nil {
+			return false
+		}
+	}
+	c.Content = c.M
+	return true
+}
+
+// acfunCPattern 匹配JSON中第一个c字段的值
+var acfunCPattern = regexp.MustCompile(`"c"\s*:\s*"([^"]*)"`)
+
+// isAcfunC 判断c字段形式的JSON弹幕是否为A站格式
+// B站c字段的第6个字段是弹幕池(0-2)，A站则是发送时间戳，据此区分两者；
+// B站c字段至少有6个字段，只有4-5个字段的是不带时间戳的旧版A站格式
+func isAcfunC(content string) bool {
+	m := acfunCPattern.FindStringSubmatch(content)
+	if m == nil {
+		return false
+	}
+	fields := strings.Split(m[1], ",")
+	if len(fields) < 6 {
+		return len(fields) >= 4
+	}
+	v, err := strconv.ParseInt(fields[5], 10, 64)
+	return err == nil && v > 9
+}
+
+// SizeMode 表示A站弹幕size字段的含义
+// 大部分文件以像素值（25为标准大小）记录字体大小，部分导出工具则使用0=小、1=中、2=大的枚举值
+type SizeMode int
+
+// 支持的size字段含义
+const (
+	SizePixels SizeMode = iota // 像素值
+	SizeEnum                   // 枚举值：0=小，1=中，2=大
+	SizeAuto                   // 自动检测：文件中所有size都在0-2范围内时按枚举值处理
+)
+
+// acfunEnumSizes 枚举值对应的像素值，与B站的小号、标准、大号字体一致
+var acfunEnumSizes = [...]int{18, 25, 36}
+
+// acfunSizes 将A站弹幕的size字段统一转换为像素值（25为标准大小）
+// 按枚举值处理时，超出范围的值视为中号
+func acfunSizes(comments []AcfunComment, mode SizeMode) {
+	if mode == SizeAuto {
+		mode = SizeEnum
+		for _, c := range comments {
+			if c.Size < 0 || c.Size >= len(acfunEnumSizes) {
+				mode = SizePixels
+				break
+			}
+		}
+	}
+	if mode != SizeEnum {
+		return
+	}
+	for i, c := range comments {
+		if c.Size >= 0 && c.Size < len(acfunEnumSizes) {
+			comments[i].Size = acfunEnumSizes[c.Size]
+		} else {
+			comments[i].Size = acfunEnumSizes[1]
+		}
+	}
+}
+
 // parseAcfun 解析A站格式的弹幕文件
 // A站弹幕使用JSON格式，将JSON数组解析为统一的Comment结构
+// 容忍BOM和末尾多余的逗号，解析失败时错误信息包含出错的行号和字节偏移；
+// 支持对象形式和c字段形式，size字段的含义由opts.AcfunSize决定
 //
 // 参数：
-//   - file: 要解析的弹幕文件
-//   - fontSize: 基准字体大小
+//   - r: 弹幕文件内容
+//   - opts: 解析选项
 //
 // 返回值：
 //   - []Comment: 解析出的弹幕列表
 //   - error: 解析错误
-func parseAcfun(file *os.File, fontSize float64) ([]Comment, error) {
+func parseAcfun(r io.Reader, opts Options) ([]Comment, error) {
 	// 解析JSON数组
 	var acComments []AcfunComment
-	if err := json.NewDecoder(file).Decode(&acComments); err != nil {
-		return nil, err
+	if err := decodeJSON(r, &acComments); err != nil {
+		return nil, fmt.Errorf("invalid AcFun JSON: %w", err)
+	}
+
+	// c字段形式先转换为对象形式，无法解析的弹幕计为无效
+	valid := acComments[:0]
+	for _, c := range acComments {
+		if c.C != "" && !parseAcfunC(&c) {
+			opts.Stats.addInvalid()
+			continue
+		}
+		valid = append(valid, c)
 	}
+	acComments = valid
+	acfunSizes(acComments, opts.AcfunSize)
 
 	comments := make([]Comment, 0, len(acComments))
 	for i, c := range acComments {
@@ -54,31 +169,42 @@ func parseAcfun(file *os.File, fontSize float64) ([]Comment, error) {
 		case 6:
 			position = 3 // 从左到右滚动弹幕
 		default:
+			opts.Stats.addUnsupported()
 			continue // 跳过不支持的模式
 		}
 
 		// 计算弹幕文本尺寸
-		// A站字体大小以25为基准，需要根据fontSize进行缩放
-		textSize := float64(c.Size) * fontSize / 25.0
+		// A站字体大小以25为基准，需要根据基准字体大小进行缩放
+		textSize := float64(c.Size) * opts.FontSize / 25.0
 		// 处理换行符
-		text := strings.Replace(c.Content, "/n", "\n", -1)
-		// 计算文本高度（考虑换行）
-		height := float64(strings.Count(text, "\n")+1) * textSize
-		// 计算文本宽度
-		width := calculateLength(text) * textSize
+		text := normalizeText(c.Content, opts)
+		// 计算文本宽度和高度（考虑换行）
+		width, height := EstimateTextSize(text, textSize)
+
+		// 最高字节不为0时为0xAARRGGBB格式，拆分出不透明度
+		color, alpha := splitARGB(c.Color)
 
 		comments = append(comments, Comment{
 			Timeline:  c.Time,
-			Timestamp: 0, // Acfun format doesn't include timestamp
+			Timestamp: c.Timestamp, // 只有c字段形式带有发送时间戳
 			No:        i,
 			Text:      text,
 			Position:  position,
-			Color:     c.Color,
+			Color:     color,
+			Alpha:     alpha,
 			Size:      textSize,
 			Height:    height,
 			Width:     width,
+			UserID:    c.UserID,
 		})
 	}
 
 	return comments, nil
 }
+
+// splitARGB 将可能带有Alpha通道的颜色值拆分为0xRRGGBB颜色和不透明度
+// 颜色值按32位无符号数处理，以兼容写成负数的有符号ARGB值；最高字节为0时不透明度返回0
+func splitARGB(argb int) (int, int) {
+	v := uint32(argb)
+	return int(v & 0xFFFFFF), int(v >> 24)
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAcfunMalformedJSON(t *testing.T) {
+	malformed := `[
+  {"time": 1.5, "mode": 1, "size": 25, "color": 16777215, "content": "正常"},
+  {"time": 2.0, "mode": 1, "size": 25 "color": 16777215, "content": "缺少逗号"}
+]`
+	_, err := parseAcfun(strings.NewReader(malformed), DefaultOptions(25))
+	if err == nil {
+		t.Fatal("malformed JSON was accepted")
+	}
+	for _, s := range []string{"invalid AcFun JSON", "line 3, column 40", "byte offset 121"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not mention %q", err, s)
+		}
+	}
+
+	// BOM和末尾多余的逗号可以容忍
+	lenient := "\ufeff" + `[{"time": 1.5, "mode": 1, "size": 25, "color": 16777215, "content": "正常",},]`
+	comments, err := parseAcfun(strings.NewReader(lenient), DefaultOptions(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].Text != "正常" {
+		t.Errorf("comments = %+v", comments)
+	}
+}
+
+// parseAcfunSizes 按mode解析size字段分别为sizes的A站弹幕，返回换算后的字号
+func parseAcfunSizes(t *testing.T, sizes []int, mode SizeMode) []float64 {
+	t.Helper()
+	var items []string
+	for _, size := range sizes {
+		items = append(items, fmt.Sprintf(`{"time": 1, "mode": 1, "size": %d, "color": 16777215, "content": "弹幕"}`, size))
+	}
+	opts := DefaultOptions(50)
+	opts.AcfunSize = mode
+	comments, err := parseAcfun(strings.NewReader("["+strings.Join(items, ",")+"]"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []float64
+	for _, c := range comments {
+		got = append(got, c.Size)
+	}
+	return got
+}
+
+func TestAcfunSizeMode(t *testing.T) {
+	// 基准字号50，像素值按25为标准大小换算
+	for _, tc := range []struct {
+		sizes []int
+		mode  SizeMode
+		want  []float64
+	}{
+		{[]int{0, 1, 2}, SizeAuto, []float64{36, 50, 72}},
+		{[]int{0, 1, 2}, SizeEnum, []float64{36, 50, 72}},
+		{[]int{18, 25, 36}, SizeAuto, []float64{36, 50, 72}},
+		{[]int{18, 25, 36}, SizePixels, []float64{36, 50, 72}},
+		{[]int{1, 25}, SizeAuto, []float64{2, 50}},
+		{[]int{1, 25}, SizeEnum, []float64{50, 50}},
+		{[]int{2}, SizePixels, []float64{4}},
+	} {
+		if got := parseAcfunSizes(t, tc.sizes, tc.mode); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("sizes %v, mode %d: got %v, want %v", tc.sizes, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestAcfunARGB(t *testing.T) {
+	comments, err := parseAcfun(strings.NewReader(`[
+  {"time": 1, "mode": 1, "size": 25, "color": 2164195328, "content": "半透明红色"},
+  {"time": 2, "mode": 1, "size": 25, "color": 16711680, "content": "红色"},
+  {"time": 3, "mode": 1, "size": 25, "color": -2130771968, "content": "有符号"}
+]`), DefaultOptions(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0x80FF0000：不透明度0x80（50%），颜色为红色；没有Alpha字节时不透明度为0（使用样式默认值）
+	want := []struct{ color, alpha int }{{0xFF0000, 0x80}, {0xFF0000, 0}, {0xFF0000, 0x80}}
+	for i, c := range comments {
+		if c.Color != want[i].color || c.Alpha != want[i].alpha {
+			t.Errorf("%s: color %06X, alpha %02X, want %06X, %02X", c.Text, c.Color, c.Alpha, want[i].color, want[i].alpha)
+		}
+	}
+}
+
+func TestAcfunCField(t *testing.T) {
+	comments := parseFixture(t, "acfun_c.json", DefaultOptions(25))
+	want := []Comment{
+		{Timeline: 1.5, Timestamp: 1600000000, Text: "带时间戳", Position: 0, Color: 0xFFFFFF, UserID: "user01"},
+		{Timeline: 2.25, Timestamp: 0, Text: "不带时间戳", Position: 1, Color: 0x00FF00, UserID: "user02"},
+		{Timeline: 3.0, Timestamp: 1600000002, Text: "底部", Position: 2, Color: 0x0000FF, UserID: "user03"},
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("got %d comments, want %d", len(comments), len(want))
+	}
+	for i, c := range comments {
+		w := want[i]
+		if c.Timeline != w.Timeline || c.Timestamp != w.Timestamp || c.Text != w.Text ||
+			c.Position != w.Position || c.Color != w.Color || c.UserID != w.UserID || c.Size != 25 {
+			t.Errorf("comment %d = %+v, want %+v", i, c, w)
+		}
+	}
+
+	// 只有5个字段的c字段形式也识别为A站格式
+	format, _, err := ProbeFormatReader(strings.NewReader(`[{"c": "2.25,65280,5,25,user02", "m": "弹幕"}]`))
+	if err != nil || format != FormatAcfun {
+		t.Errorf("5-field c: format = %v, %v, want %v", format, err, FormatAcfun)
+	}
+}
+
+func TestAcfunCRLF(t *testing.T) {
+	lf := parseFixture(t, "acfun_lf.json", DefaultOptions(25))
+	crlf := parseFixture(t, "acfun_crlf.json", DefaultOptions(25))
+	if len(lf) != 3 {
+		t.Fatalf("LF fixture gave %d comments, want 3", len(lf))
+	}
+	if !reflect.DeepEqual(crlf, lf) {
+		t.Errorf("CRLF comments = %+v, want %+v", crlf, lf)
+	}
+	if want := []string{"第一行\n第二行", "转义的\n换行", "c字段"}; !reflect.DeepEqual(texts(lf), want) {
+		t.Errorf("texts = %q, want %q", texts(lf), want)
+	}
+}
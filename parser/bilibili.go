@@ -2,19 +2,24 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"os"
+	"io"
+	"strconv"
 	"strings"
 )
 
 // BilibiliComment 表示B站弹幕的XML结构
 // B站弹幕XML格式示例：
 // <d p="时间,模式,字体大小,颜色,时间戳,弹幕池,用户ID,弹幕ID">弹幕内容</d>
+// 部分导出工具会用hidden="1"标记已被举报或屏蔽的弹幕
 type BilibiliComment struct {
-	XMLName xml.Name `xml:"d"`         // XML标签名为d
-	P       string   `xml:"p,attr"`    // p属性包含弹幕信息
-	Content string   `xml:",chardata"` // 弹幕文本内容
+	XMLName xml.Name `xml:"d"`           // XML标签名为d
+	P       string   `xml:"p,attr"`      // p属性包含弹幕信息
+	Hidden  string   `xml:"hidden,attr"` // 弹幕是否被隐藏（1或true）
+	Content string   `xml:",chardata"`   // 弹幕文本内容
 }
 
 // BilibiliXML 表示B站弹幕文件的根XML结构
@@ -23,63 +28,279 @@ type BilibiliXML struct {
 	Comments []BilibiliComment `xml:"d"` // 所有弹幕评论
 }
 
+// bilibiliAttr 表示从B站p属性中解析出的弹幕属性
+type bilibiliAttr struct {
+	Timeline  float64 // 弹幕出现时间（秒）
+	Mode      int     // 弹幕模式
+	Size      int     // 字体大小（25为标准大小）
+	Color     int     // 字体颜色（十进制RGB值）
+	Timestamp int64   // 发送时间戳
+	Pool      int     // 弹幕池
+	UserID    string  // 发送者用户ID的哈希，可能缺失
+}
+
 // parseBilibili 解析B站格式的弹幕文件
 // B站弹幕文件使用XML格式，每条弹幕包含详细的属性信息
-func parseBilibili(file *os.File, fontSize float64) ([]Comment, error) {
-	var biliXML BilibiliXML
-	if err := xml.NewDecoder(file).Decode(&biliXML); err != nil {
-		return nil, err
+// 批量下载的文件可能由多个XML文档直接拼接而成，所有<i>根节点中的弹幕都会被读取；
+// 时间字段的单位由opts.TimeUnit决定
+func parseBilibili(r io.Reader, opts Options) ([]Comment, error) {
+	all, err := readBilibiliComments(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bilibili XML: %w", err)
 	}
 
-	comments := make([]Comment, 0, len(biliXML.Comments))
-	for i, c := range biliXML.Comments {
-		// 解析p属性（格式：时间,模式,字体大小,颜色,时间戳,弹幕池,用户ID,弹幕ID）
-		var (
-			timeline  float64
-			mode      string
-			size      int
-			color     int
-			timestamp int64
-		)
-
-		_, err := fmt.Sscanf(c.P, "%f,%s,%d,%d,%d", &timeline, &mode, &size, &color, &timestamp)
-		if err != nil {
+	comments := make([]Comment, 0, len(all))
+	for i, c := range all {
+		attr, ok := parseBilibiliAttr(c.P)
+		if !ok {
+			opts.Stats.addInvalid()
 			continue // Skip invalid comments
 		}
 
-		// 将B站的弹幕模式转换为统一的位置类型
-		var position int
-		switch mode {
-		case "1":
-			position = 0 // 从右到左滚动弹幕
-		case "4":
-			position = 2 // 底部固定弹幕
-		case "5":
-			position = 1 // 顶部固定弹幕
-		case "6":
-			position = 3 // 从左到右滚动弹幕
-		default:
+		comment, ok := newBilibiliComment(i, attr, c.Content, opts)
+		if !ok {
+			countSkippedMode(opts.Stats, attr.Mode)
 			continue // Skip unsupported modes
 		}
+		comment.Hidden, _ = strconv.ParseBool(c.Hidden)
+
+		comments = append(comments, comment)
+	}
+
+	if millisecondTimes(comments, opts.TimeUnit) {
+		for i := range comments {
+			comments[i].Timeline /= 1000
+		}
+	}
+
+	return comments, nil
+}
+
+// millisecondTimes 判断弹幕时间是否应按毫秒处理
+// 自动检测时只要有一条弹幕的时间超过AutoMillisecondsThreshold就认为整个文件使用毫秒
+func millisecondTimes(comments []Comment, unit TimeUnit) bool {
+	switch unit {
+	case TimeUnitMilliseconds:
+		return true
+	case TimeUnitAuto:
+		for _, c := range comments {
+			if c.Timeline > AutoMillisecondsThreshold {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readBilibiliComments 读取输入中所有的<d>元素
+// 开启opts.Fast时先尝试直接扫描，无法处理的文件再使用encoding/xml解码
+func readBilibiliComments(r io.Reader, opts Options) ([]BilibiliComment, error) {
+	if opts.Fast {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if comments, ok := scanBilibili(data); ok {
+			return comments, nil
+		}
+		r = bytes.NewReader(data)
+	}
 
-		// 计算弹幕文本尺寸
-		textSize := float64(size) * fontSize / 25.0
-		text := strings.Replace(c.Content, "/n", "\n", -1)
-		height := float64(strings.Count(text, "\n")+1) * textSize
-		width := calculateLength(text) * textSize
-
-		comments = append(comments, Comment{
-			Timeline:  timeline,
-			Timestamp: timestamp,
-			No:        i,
-			Text:      text,
-			Position:  position,
-			Color:     color,
-			Size:      textSize,
-			Height:    height,
-			Width:     width,
-		})
+	documents, err := decodeBilibiliDocuments(r, opts)
+	if err != nil {
+		return nil, err
 	}
 
+	var comments []BilibiliComment
+	for _, doc := range documents {
+		comments = append(comments, doc.Comments...)
+	}
 	return comments, nil
 }
+
+// decodeBilibiliDocuments 循环解码输入中的所有<i>文档直到EOF
+// 输入中没有任何文档时返回解码错误
+func decodeBilibiliDocuments(r io.Reader, opts Options) ([]BilibiliXML, error) {
+	var documents []BilibiliXML
+	decoder := newXMLDecoder(r, opts)
+	for {
+		var doc BilibiliXML
+		err := decoder.Decode(&doc)
+		if err == io.EOF && len(documents) > 0 {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+}
+
+// parseBilibiliAttr 解析B站弹幕的p属性
+// 格式：时间,模式,字体大小,颜色,时间戳,弹幕池,用户ID,弹幕ID
+// 任意字段缺失或无法解析时返回false
+func parseBilibiliAttr(p string) (bilibiliAttr, bool) {
+	var attr bilibiliAttr
+
+	fields := strings.Split(p, ",")
+	if len(fields) < 6 {
+		return attr, false
+	}
+
+	var err error
+	if attr.Timeline, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return attr, false
+	}
+	if attr.Mode, err = strconv.Atoi(fields[1]); err != nil {
+		return attr, false
+	}
+	if attr.Size, err = strconv.Atoi(fields[2]); err != nil {
+		return attr, false
+	}
+	// 部分导出文件的颜色字段为空，按0处理，由调用方替换为默认颜色
+	if fields[3] != "" {
+		if attr.Color, err = strconv.Atoi(fields[3]); err != nil {
+			return attr, false
+		}
+	}
+	if attr.Timestamp, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+		return attr, false
+	}
+	if attr.Pool, err = strconv.Atoi(fields[5]); err != nil {
+		return attr, false
+	}
+	if len(fields) > 6 {
+		attr.UserID = fields[6]
+	}
+
+	return attr, true
+}
+
+// bilibiliPosition 将B站的弹幕模式转换为统一的位置类型
+// 不支持的模式返回false
+func bilibiliPosition(mode int) (int, bool) {
+	switch mode {
+	case 1:
+		return 0, true // 从右到左滚动弹幕
+	case 4:
+		return 2, true // 底部固定弹幕
+	case 5:
+		return 1, true // 顶部固定弹幕
+	case 6:
+		return 3, true // 从左到右滚动弹幕
+	case 7:
+		return 4, true // 定位弹幕
+	default:
+		return 0, false
+	}
+}
+
+// isAdvancedMode 判断是否为B站高级弹幕模式
+// 7为定位弹幕，8为代码弹幕，9为BAS弹幕，内容不是可以直接显示的文本；
+// 定位弹幕可以转换为固定位置的弹幕，只有内容无法解析时才计为跳过的高级弹幕
+func isAdvancedMode(mode int) bool {
+	return mode == 7 || mode == 8 || mode == 9
+}
+
+// countSkippedMode 按弹幕模式累计因模式不受支持而跳过的弹幕数
+// 高级弹幕单独计数，便于与真正未知的模式区分
+func countSkippedMode(stats *Stats, mode int) {
+	if isAdvancedMode(mode) {
+		stats.addAdvanced()
+		return
+	}
+	stats.addUnsupported()
+}
+
+// newBilibiliComment 根据B站弹幕属性构造统一的Comment结构
+// XML和JSON两种B站格式共用此函数，弹幕模式不受支持时返回false
+func newBilibiliComment(no int, attr bilibiliAttr, content string, opts Options) (Comment, bool) {
+	position, ok := bilibiliPosition(attr.Mode)
+	if !ok {
+		return Comment{}, false
+	}
+
+	// 定位弹幕的内容是包含坐标和文本的JSON数组
+	var x, y, duration float64
+	if position == 4 {
+		if x, y, duration, content, ok = parsePositioned(content); !ok {
+			return Comment{}, false
+		}
+	}
+
+	// 计算弹幕文本尺寸
+	textSize := float64(attr.Size) * opts.FontSize / 25.0
+	text := normalizeText(content, opts)
+	width, height := EstimateTextSize(text, textSize)
+
+	// 颜色缺失或为0时使用默认颜色，避免黑色弹幕融入黑色描边
+	color := attr.Color
+	if color == 0 {
+		color = opts.DefaultColor
+	}
+
+	return Comment{
+		Timeline:  attr.Timeline,
+		Timestamp: attr.Timestamp,
+		No:        no,
+		Text:      text,
+		Position:  position,
+		Color:     color,
+		Size:      textSize,
+		Height:    height,
+		Width:     width,
+		Pool:      attr.Pool,
+		UserID:    attr.UserID,
+		Duration:  duration,
+		X:         x,
+		Y:         y,
+	}, true
+}
+
+// bilibiliPlayerWidth、bilibiliPlayerHeight B站定位弹幕使用像素坐标时参照的播放器尺寸
+const (
+	bilibiliPlayerWidth  = 672
+	bilibiliPlayerHeight = 438
+)
+
+// parsePositioned 解析B站定位弹幕（模式7）的内容
+// 内容为JSON数组：[x, y, "透明度", 持续时间, "文本", ...]，后续的旋转、移动等字段被忽略；
+// 其中的描边字段只表示是否描边而没有描边颜色，因此不设置OutlineColor。
+// 坐标不超过1时为相对于屏幕的比例，否则为播放器中的像素坐标，统一换算为比例；
+// 数组中的数值可能写成字符串。内容无法解析时返回false
+func parsePositioned(content string) (x, y, duration float64, text string, ok bool) {
+	var fields []any
+	if err := json.Unmarshal([]byte(content), &fields); err != nil || len(fields) < 5 {
+		return 0, 0, 0, "", false
+	}
+
+	values := make([]float64, 3)
+	for i, index := range []int{0, 1, 3} {
+		if values[i], ok = jsonNumber(fields[index]); !ok {
+			return 0, 0, 0, "", false
+		}
+	}
+	if text, ok = fields[4].(string); !ok {
+		return 0, 0, 0, "", false
+	}
+
+	x, y, duration = values[0], values[1], values[2]
+	if x > 1 || y > 1 {
+		x /= bilibiliPlayerWidth
+		y /= bilibiliPlayerHeight
+	}
+	return x, y, duration, text, true
+}
+
+// jsonNumber 将JSON中的数值或数值字符串转换为float64
+func jsonNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,363 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// scanBilibili 不经过encoding/xml，直接扫描B站XML中的<d p="...">弹幕内容</d>元素
+// 只接受B站弹幕文件的常见结构：可选的UTF-8 XML声明，之后是一个或多个没有属性的<i>根元素，
+// 根元素中只有空白和不含子元素的元素（如<chatid>、<d>）。遇到注释、DOCTYPE、处理指令、
+// 嵌套元素、带命名空间的名称、未知实体、非法字符、非UTF-8编码声明或缺少</i>结束标签等情况时返回false，
+// 由调用方改用通用的XML解码器，保证两种方式得到的结果（包括错误）完全相同
+func scanBilibili(data []byte) ([]BilibiliComment, bool) {
+	s := string(data)
+	var comments []BilibiliComment
+	documents := 0
+	for {
+		// 根元素之外只允许空白（第一个文档前可以有BOM）和XML声明
+		s = trimXMLSpace(s)
+		if documents == 0 && strings.HasPrefix(s, "\ufeff") {
+			s = trimXMLSpace(strings.TrimPrefix(s, "\ufeff"))
+		}
+		if s == "" {
+			return comments, documents > 0
+		}
+		if strings.HasPrefix(s, "<?xml ") || strings.HasPrefix(s, "<?xml?") {
+			rest, ok := scanDeclaration(s)
+			if !ok {
+				return nil, false
+			}
+			s = rest
+			continue
+		}
+
+		name, attrs, empty, rest, ok := scanStartTag(s)
+		if !ok || name != "i" || len(attrs) > 0 || empty {
+			return nil, false
+		}
+		s = rest
+
+		// 根元素的子元素
+		for {
+			lt := strings.IndexByte(s, '<')
+			if lt < 0 || trimXMLSpace(s[:lt]) != "" {
+				return nil, false
+			}
+			s = s[lt:]
+			if strings.HasPrefix(s, "</") {
+				name, rest, ok := scanEndTag(s)
+				if !ok || name != "i" {
+					return nil, false
+				}
+				s = rest
+				documents++
+				break
+			}
+
+			name, attrs, empty, rest, ok := scanStartTag(s)
+			if !ok {
+				return nil, false
+			}
+			s = rest
+			var content string
+			if !empty {
+				end := strings.Index(s, "</")
+				if end < 0 {
+					return nil, false
+				}
+				if content, ok = scanCharData(s[:end]); !ok {
+					return nil, false
+				}
+				endName, rest, ok := scanEndTag(s[end:])
+				if !ok || endName != name {
+					return nil, false
+				}
+				s = rest
+			}
+			if name == "d" {
+				comments = append(comments, BilibiliComment{
+					XMLName: xml.Name{Local: "d"},
+					P:       attrs["p"],
+					Hidden:  attrs["hidden"],
+					Content: content,
+				})
+			}
+		}
+	}
+}
+
+// scanDeclaration 跳过<?xml ...?>声明，只接受1.0版本和UTF-8编码（或未声明编码）
+func scanDeclaration(s string) (string, bool) {
+	end := strings.Index(s, "?>")
+	if end < 0 {
+		return "", false
+	}
+	attrs, ok := scanAttrs(s[len("<?xml"):end])
+	if !ok {
+		return "", false
+	}
+	if version, has := attrs["version"]; has && version != "1.0" {
+		return "", false
+	}
+	if encoding, has := attrs["encoding"]; has && !isUTF8(encoding) {
+		return "", false
+	}
+	return s[end+2:], true
+}
+
+// scanStartTag 解析s开头的开始标签，返回标签名、属性、是否自闭合以及标签之后的内容
+// 注释、CDATA、处理指令等不以名称开头的标记返回false
+func scanStartTag(s string) (name string, attrs map[string]string, empty bool, rest string, ok bool) {
+	name = scanName(s[1:])
+	if name == "" {
+		return "", nil, false, "", false
+	}
+	s = s[1+len(name):]
+
+	// 属性部分到第一个不在引号中的>为止
+	quote := byte(0)
+	end := -1
+	for i := 0; i < len(s) && end < 0; i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '>':
+			end = i
+		}
+	}
+	if end < 0 {
+		return "", nil, false, "", false
+	}
+	inner := s[:end]
+	if strings.HasSuffix(inner, "/") {
+		empty = true
+		inner = inner[:len(inner)-1]
+	}
+	if inner != "" && !isXMLSpace(inner[0]) {
+		return "", nil, false, "", false
+	}
+	if attrs, ok = scanAttrs(inner); !ok {
+		return "", nil, false, "", false
+	}
+	return name, attrs, empty, s[end+1:], true
+}
+
+// scanEndTag 解析s开头的结束标签，返回标签名和标签之后的内容
+func scanEndTag(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "</") {
+		return "", "", false
+	}
+	name := scanName(s[2:])
+	rest := trimXMLSpace(s[2+len(name):])
+	if name == "" || !strings.HasPrefix(rest, ">") {
+		return "", "", false
+	}
+	return name, rest[1:], true
+}
+
+// scanName 返回s开头的元素名或属性名
+// 只接受ASCII字母、数字、下划线、连字符和点组成的名称，带命名空间前缀的名称返回空字符串
+func scanName(s string) string {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		if !letter && (i == 0 || !(c >= '0' && c <= '9' || c == '-' || c == '.')) {
+			break
+		}
+		i++
+	}
+	if i < len(s) && s[i] == ':' {
+		return ""
+	}
+	return s[:i]
+}
+
+// scanAttrs 解析标签的属性部分并解码实体
+// 属性之间必须有空白；格式无法识别、属性重复、声明命名空间或值中含有<、回车或非法字符时返回false
+func scanAttrs(s string) (map[string]string, bool) {
+	attrs := make(map[string]string)
+	for {
+		trimmed := trimXMLSpace(s)
+		if trimmed == "" {
+			return attrs, true
+		}
+		if len(attrs) > 0 && len(trimmed) == len(s) {
+			return nil, false
+		}
+		s = trimmed
+
+		key := scanName(s)
+		if key == "" || key == "xmlns" {
+			return nil, false
+		}
+		s = trimXMLSpace(s[len(key):])
+		if !strings.HasPrefix(s, "=") {
+			return nil, false
+		}
+		s = trimXMLSpace(s[1:])
+		if s == "" || (s[0] != '"' && s[0] != '\'') {
+			return nil, false
+		}
+		closing := strings.IndexByte(s[1:], s[0])
+		if closing < 0 {
+			return nil, false
+		}
+		raw := s[1 : closing+1]
+		s = s[closing+2:]
+
+		// encoding/xml将属性值中的换行和制表符保持原样，只解码实体
+		if strings.ContainsAny(raw, "<\r") {
+			return nil, false
+		}
+		value, ok := unescapeXML(raw)
+		if !ok || !validXMLChars(value) {
+			return nil, false
+		}
+		if _, dup := attrs[key]; dup {
+			return nil, false
+		}
+		attrs[key] = value
+	}
+}
+
+// trimXMLSpace 去掉开头的XML空白字符（空格、制表符、回车、换行）
+func trimXMLSpace(s string) string {
+	for s != "" && isXMLSpace(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
+
+// isXMLSpace 判断字节是否为XML空白字符
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// validXMLChars 判断字符串是否为合法的UTF-8且只包含XML允许的字符
+func validXMLChars(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return false
+		}
+	}
+	return true
+}
+
+// scanCharData 解码元素的文本内容，处理实体、CDATA和换行符规范化
+// 文本中包含其他标签或注释时返回false
+func scanCharData(s string) (string, bool) {
+	var b strings.Builder
+	for s != "" {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			text, ok := unescapeXML(s)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(text)
+			break
+		}
+
+		text, ok := unescapeXML(s[:lt])
+		if !ok {
+			return "", false
+		}
+		b.WriteString(text)
+		s = s[lt:]
+
+		if !strings.HasPrefix(s, "<![CDATA[") {
+			return "", false
+		}
+		end := strings.Index(s, "]]>")
+		if end < 0 {
+			return "", false
+		}
+		b.WriteString(s[len("<![CDATA["):end])
+		s = s[end+3:]
+	}
+
+	// 与encoding/xml一致：将\r\n和单独的\r转换为\n
+	text := b.String()
+	if strings.Contains(text, "\r") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	if !validXMLChars(text) {
+		return "", false
+	}
+	return text, true
+}
+
+// unescapeXML 解码XML预定义实体和数字字符引用，遇到未知实体时返回false
+func unescapeXML(s string) (string, bool) {
+	if !strings.Contains(s, "&") {
+		return s, true
+	}
+
+	var b strings.Builder
+	for {
+		amp := strings.IndexByte(s, '&')
+		if amp < 0 {
+			b.WriteString(s)
+			return b.String(), true
+		}
+		b.WriteString(s[:amp])
+		s = s[amp:]
+
+		semi := strings.IndexByte(s, ';')
+		if semi < 0 {
+			return "", false
+		}
+		entity := s[1:semi]
+		s = s[semi+1:]
+
+		switch entity {
+		case "lt":
+			b.WriteByte('<')
+		case "gt":
+			b.WriteByte('>')
+		case "amp":
+			b.WriteByte('&')
+		case "quot":
+			b.WriteByte('"')
+		case "apos":
+			b.WriteByte('\'')
+		default:
+			r, ok := charRef(entity)
+			if !ok {
+				return "", false
+			}
+			b.WriteRune(r)
+		}
+	}
+}
+
+// charRef 解析&#NNN;和&#xHHH;形式的数字字符引用（不含&和;）
+func charRef(entity string) (rune, bool) {
+	if !strings.HasPrefix(entity, "#") {
+		return 0, false
+	}
+	var n uint64
+	var err error
+	if strings.HasPrefix(entity, "#x") {
+		n, err = strconv.ParseUint(entity[2:], 16, 32)
+	} else {
+		n, err = strconv.ParseUint(entity[1:], 10, 32)
+	}
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return 0, false
+	}
+	return rune(n), true
+}
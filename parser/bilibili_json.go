@@ -0,0 +1,72 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"fmt"
+	"io"
+)
+
+// BilibiliJSONComment 表示第三方工具导出的B站JSON弹幕结构
+// 常见两种形式：
+//
+//	{"c": "时间,模式,字体大小,颜色,时间戳,弹幕池,用户ID,弹幕ID", "m": "弹幕内容"}
+//	{"progress": 12340, "mode": 1, "fontsize": 25, "color": 16777215, "content": "弹幕内容"}
+//
+// 展开形式与B站protobuf接口一致，progress的单位为毫秒
+type BilibiliJSONComment struct {
+	C        string `json:"c"`        // 与XML格式p属性相同的逗号分隔字符串
+	M        string `json:"m"`        // 弹幕内容（与c搭配使用）
+	Progress int64  `json:"progress"` // 弹幕出现时间（毫秒）
+	Mode     int    `json:"mode"`     // 弹幕模式
+	FontSize int    `json:"fontsize"` // 字体大小（25为标准大小）
+	Color    int    `json:"color"`    // 字体颜色（十进制RGB值）
+	Ctime    int64  `json:"ctime"`    // 发送时间戳
+	Pool     int    `json:"pool"`     // 弹幕池
+	Content  string `json:"content"`  // 弹幕内容（展开形式）
+}
+
+// parseBilibiliJSON 解析JSON格式的B站弹幕文件
+// 与XML格式共用弹幕模式映射和尺寸计算逻辑
+func parseBilibiliJSON(r io.Reader, opts Options) ([]Comment, error) {
+	var biliComments []BilibiliJSONComment
+	if err := decodeJSON(r, &biliComments); err != nil {
+		return nil, fmt.Errorf("invalid Bilibili JSON: %w", err)
+	}
+
+	comments := make([]Comment, 0, len(biliComments))
+	for i, c := range biliComments {
+		var (
+			attr    bilibiliAttr
+			content string
+		)
+
+		if c.C != "" {
+			var ok bool
+			if attr, ok = parseBilibiliAttr(c.C); !ok {
+				opts.Stats.addInvalid()
+				continue // Skip invalid comments
+			}
+			content = c.M
+		} else {
+			attr = bilibiliAttr{
+				Timeline:  float64(c.Progress) / 1000.0,
+				Mode:      c.Mode,
+				Size:      c.FontSize,
+				Color:     c.Color,
+				Timestamp: c.Ctime,
+				Pool:      c.Pool,
+			}
+			content = c.Content
+		}
+
+		comment, ok := newBilibiliComment(i, attr, content, opts)
+		if !ok {
+			countSkippedMode(opts.Stats, attr.Mode)
+			continue // Skip unsupported modes
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
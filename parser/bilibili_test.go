@@ -0,0 +1,316 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBilibiliJSON(t *testing.T) {
+	stats := &Stats{}
+	opts := DefaultOptions(25)
+	opts.Stats = stats
+	comments := parseFixture(t, "bilibili.json", opts)
+	if len(comments) != 2 {
+		t.Fatalf("parsed %d comments, want 2", len(comments))
+	}
+
+	c := comments[0]
+	if c.Timeline != 1.5 || c.Position != 0 || c.Color != 0xFFFFFF || c.Timestamp != 1600000000 || c.UserID != "a1b2c3d4" || c.Text != "c字段形式" {
+		t.Errorf("c/m comment = %+v", c)
+	}
+	c = comments[1]
+	if c.Timeline != 3.25 || c.Position != 1 || c.Color != 0xFF0000 || c.Size != 36 || c.Pool != 1 || c.Text != "展开形式" {
+		t.Errorf("progress comment = %+v", c)
+	}
+	if stats.Parsed[FormatBilibiliJSON] != 2 || stats.Advanced != 1 {
+		t.Errorf("stats = %+v, want 2 parsed and 1 advanced", stats)
+	}
+}
+
+func TestParseBilibiliJSONBOM(t *testing.T) {
+	comments := parseFixture(t, "bilibili_bom.json", DefaultOptions(25))
+	if got, want := texts(comments), []string{"带BOM的弹幕", "展开形式"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("texts = %q, want %q", got, want)
+	}
+
+	// 与其他JSON解析器一样，错误信息包含行号和列号
+	_, err := parseBilibiliJSON(strings.NewReader("[\n  {\"c\": \"1,1,25,16777215,0,0,u,1\" \"m\": \"x\"}\n]"), DefaultOptions(25))
+	if err == nil || !strings.Contains(err.Error(), "line 2, column") {
+		t.Errorf("err = %v, want a line and column", err)
+	}
+}
+
+func TestParseBilibiliTruncated(t *testing.T) {
+	file, err := os.Open("../test/bilibili_truncated.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = ParseComments(file, FormatBilibili, 25)
+	if err == nil {
+		t.Fatal("truncated XML was accepted")
+	}
+	for _, s := range []string{"bilibili_truncated.xml", "invalid Bilibili XML", "detected format Bilibili", "truncated"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q does not mention %q", err, s)
+		}
+	}
+}
+
+// parseBilibiliString 解析字符串形式的B站XML弹幕
+func parseBilibiliString(t *testing.T, xml string, opts Options) []Comment {
+	t.Helper()
+	comments, err := parseBilibili(strings.NewReader(xml), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comments
+}
+
+func TestBilibiliDefaultColor(t *testing.T) {
+	const xml = `<i>
+<d p="1,1,25,0,0,0">零</d>
+<d p="2,1,25,,0,0">缺失</d>
+<d p="3,1,25,255,0,0">蓝色</d>
+</i>`
+
+	comments := parseBilibiliString(t, xml, DefaultOptions(25))
+	want := []int{0xFFFFFF, 0xFFFFFF, 0x0000FF}
+	for i, c := range comments {
+		if c.Color != want[i] {
+			t.Errorf("%s color = %06X, want %06X", c.Text, c.Color, want[i])
+		}
+	}
+
+	opts := DefaultOptions(25)
+	opts.DefaultColor = 0xFFFF00
+	if c := parseBilibiliString(t, xml, opts)[0]; c.Color != 0xFFFF00 {
+		t.Errorf("color with -default-color = %06X, want FFFF00", c.Color)
+	}
+}
+
+func TestBilibiliTrim(t *testing.T) {
+	const xml = `<i><d p="1,1,25,16777215,0,0">  前后有空格  </d></i>`
+
+	if c := parseBilibiliString(t, xml, DefaultOptions(25))[0]; c.Text != "  前后有空格  " {
+		t.Errorf("untrimmed text = %q", c.Text)
+	}
+
+	opts := DefaultOptions(25)
+	opts.Trim = true
+	c := parseBilibiliString(t, xml, opts)[0]
+	if c.Text != "前后有空格" {
+		t.Errorf("trimmed text = %q", c.Text)
+	}
+	// 尺寸按去除空白后的文本计算
+	if w, _ := EstimateTextSize("前后有空格", 25); c.Width != w {
+		t.Errorf("trimmed width = %v, want %v", c.Width, w)
+	}
+}
+
+func TestBilibiliCDATAAndEntities(t *testing.T) {
+	comments := parseBilibiliString(t, `<i>
+<d p="1,1,25,16777215,0,0"><![CDATA[<b>不是标签</b> & 符号]]></d>
+<d p="2,1,25,16777215,0,0">&lt;3 &amp; &quot;引号&quot; &#x2764; &#9733;</d>
+</i>`, DefaultOptions(25))
+
+	want := []string{"<b>不是标签</b> & 符号", `<3 & "引号" ❤ ★`}
+	if got := texts(comments); !reflect.DeepEqual(got, want) {
+		t.Errorf("texts = %q, want %q", got, want)
+	}
+}
+
+func TestBilibiliConcatenated(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<i><chatid>%d</chatid><d p="%d,1,25,16777215,0,0">第%d集</d></i>
+`
+	comments := parseBilibiliString(t, fmt.Sprintf(doc, 1, 1, 1)+fmt.Sprintf(doc, 2, 2, 2), DefaultOptions(25))
+	if got := texts(comments); !reflect.DeepEqual(got, []string{"第1集", "第2集"}) {
+		t.Errorf("texts = %q", got)
+	}
+}
+
+func TestBilibiliMilliseconds(t *testing.T) {
+	want := []float64{1.5, 90.25, 3600}
+	for _, unit := range []TimeUnit{TimeUnitMilliseconds, TimeUnitAuto} {
+		opts := DefaultOptions(25)
+		opts.TimeUnit = unit
+		comments := parseFixture(t, "bilibili_ms.xml", opts)
+		var got []float64
+		for _, c := range comments {
+			got = append(got, c.Timeline)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unit %d: times = %v, want %v", unit, got, want)
+		}
+	}
+
+	// 默认按秒处理，不做任何换算
+	comments := parseFixture(t, "bilibili_ms.xml", DefaultOptions(25))
+	if comments[0].Timeline != 1500 {
+		t.Errorf("seconds: first time = %v, want 1500", comments[0].Timeline)
+	}
+	// 自动检测不会误判正常的秒级时间
+	opts := DefaultOptions(25)
+	opts.TimeUnit = TimeUnitAuto
+	comments = parseFixture(t, "bilibili_pools.xml", opts)
+	if comments[0].Timeline != 1.5 {
+		t.Errorf("auto: seconds file was scaled, first time = %v", comments[0].Timeline)
+	}
+}
+
+// scanCases 快速扫描的交叉检查用例，fast表示是否应由快速扫描处理
+var scanCases = []struct {
+	name string
+	xml  string
+	fast bool
+}{
+	{"synthetic", syntheticBilibili(20), true},
+	{"metadata", `<?xml version="1.0" encoding="UTF-8"?><i><chatserver>chat.bilibili.com</chatserver><chatid>1</chatid><source>k-v</source><d p="1,1,25,16777215,0,0,u,1">弹幕</d></i>`, true},
+	{"entities and CDATA", `<i><d p="1,1,25,16777215,0,0,u,1">a &amp; b &#x4E2D;&#25991; <![CDATA[<x>&amp;]]></d></i>`, true},
+	{"hidden", `<i><d p="1,1,25,16777215,0,0,u,1" hidden="1">x</d><d p="2,1,25,16777215,0,0,u,2" hidden='true'>y</d></i>`, true},
+	{"single quotes and CRLF", "<i>\r\n<d p='1,1,25,16777215,0,0,u,1'>a\r\nb\rc</d>\r\n</i>\r\n", true},
+	{"empty elements", `<i><chatid/><d p="1,1,25,16777215,0,0,u,1"></d><d p="2,1,25,16777215,0,0,u,2"/></i>`, true},
+	{"greater-than in attribute", `<i><d p="1,1,25,16777215,0,0,u>1,1">x</d></i>`, true},
+	{"spaces in tags", "<i >\n<d\tp = \"1,1,25,16777215,0,0,u,1\" >x</d >\n</i >", true},
+	{"BOM", "\ufeff<?xml version=\"1.0\"?><i><d p=\"1,1,25,16777215,0,0,u,1\">x</d></i>", true},
+	{"concatenated", `<?xml version="1.0" encoding="utf-8"?><i><d p="1,1,25,16777215,0,0,u,1">x</d></i>
+<?xml version="1.0" encoding="utf-8"?><i><d p="2,1,25,16777215,0,0,u,2">y</d></i>`, true},
+
+	{"comment before root", `<!-- dump --><i><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"comment in root", `<i><!-- <d p="9,1,25,16777215,0,0,u,9">hidden</d> --><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"comment in content", `<i><d p="1,1,25,16777215,0,0,u,1">x<!-- y --></d></i>`, false},
+	{"DOCTYPE", `<!DOCTYPE i><i><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"stylesheet", `<?xml-stylesheet href="a.xsl"?><i><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"PI in root", `<i><?pi x?><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"other root", `<danmaku><d p="1,1,25,16777215,0,0,u,1">x</d></danmaku>`, false},
+	{"wrapped root", `<packet><i><d p="1,1,25,16777215,0,0,u,1">x</d></i></packet>`, false},
+	{"nested in d", `<i><d p="1,1,25,16777215,0,0,u,1"><b>x</b></d></i>`, false},
+	{"nested d", `<i><list><d p="1,1,25,16777215,0,0,u,1">x</d></list></i>`, false},
+	{"prefixed element", `<i xmlns:x="urn:x"><x:d p="1,1,25,16777215,0,0,u,1">x</x:d></i>`, false},
+	{"prefixed attribute", `<i><d x:p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"root attribute", `<i xmlns="urn:x"><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"GBK", `<?xml version="1.0" encoding="GBK"?><i><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"XML 1.1", `<?xml version="1.1"?><i><d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"unknown entity", `<i><d p="1,1,25,16777215,0,0,u,1">a&nbsp;b</d></i>`, false},
+	{"control character", "<i><d p=\"1,1,25,16777215,0,0,u,1\">a\x01b</d></i>", false},
+	{"invalid UTF-8", "<i><d p=\"1,1,25,16777215,0,0,u,1\">a\xffb</d></i>", false},
+	{"missing end", `<i><d p="1,1,25,16777215,0,0,u,1">x</d>`, false},
+	{"mismatched end", `<i><d p="1,1,25,16777215,0,0,u,1">x</e></i>`, false},
+	{"duplicate attribute", `<i><d p="1,1,25,16777215,0,0,u,1" p="2,1,25,16777215,0,0,u,2">x</d></i>`, false},
+	{"text in root", `<i>hello<d p="1,1,25,16777215,0,0,u,1">x</d></i>`, false},
+	{"no root", `   `, false},
+}
+
+func TestScanBilibiliMatchesDecoder(t *testing.T) {
+	for _, tc := range scanCases {
+		scanned, ok := scanBilibili([]byte(tc.xml))
+		if ok != tc.fast {
+			t.Errorf("%s: scanned = %v, want %v", tc.name, ok, tc.fast)
+		}
+
+		documents, err := decodeBilibiliDocuments(strings.NewReader(tc.xml), DefaultOptions(25))
+		var decoded []BilibiliComment
+		for _, doc := range documents {
+			decoded = append(decoded, doc.Comments...)
+		}
+		if ok && err != nil {
+			t.Errorf("%s: scanned a document the decoder rejects: %v", tc.name, err)
+		}
+		if ok && !reflect.DeepEqual(scanned, decoded) {
+			t.Errorf("%s: scanned %+v\ndecoded %+v", tc.name, scanned, decoded)
+		}
+
+		// 无论是否走快速路径，解析结果和错误都相同
+		fast := DefaultOptions(25)
+		fast.Fast = true
+		want, wantErr := parseBilibili(strings.NewReader(tc.xml), DefaultOptions(25))
+		got, gotErr := parseBilibili(strings.NewReader(tc.xml), fast)
+		if fmt.Sprint(gotErr) != fmt.Sprint(wantErr) || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Fast gave %+v, %v\nwant %+v, %v", tc.name, got, gotErr, want, wantErr)
+		}
+	}
+}
+
+func BenchmarkParseBilibili(b *testing.B) {
+	benchmarkParseBilibili(b, false)
+}
+
+func BenchmarkParseBilibiliFast(b *testing.B) {
+	benchmarkParseBilibili(b, true)
+}
+
+func benchmarkParseBilibili(b *testing.B, fast bool) {
+	data := syntheticBilibili(10000)
+	opts := DefaultOptions(25)
+	opts.Fast = fast
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseBilibili(strings.NewReader(data), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBilibiliAdvancedModes(t *testing.T) {
+	stats := &Stats{}
+	opts := DefaultOptions(25)
+	opts.Stats = stats
+	comments := parseBilibiliString(t, `<i>
+<d p="1,1,25,16777215,0,0,u,1">普通</d>
+<d p="2,9,25,16777215,0,0,u,2">def text = $.createText("BAS")</d>
+<d p="3,9,25,16777215,0,0,u,3">def button = $.createButton()</d>
+<d p="4,8,25,16777215,0,0,u,4">var a = 1;</d>
+<d p="5,99,25,16777215,0,0,u,5">未知模式</d>
+</i>`, opts)
+
+	if got := texts(comments); !reflect.DeepEqual(got, []string{"普通"}) {
+		t.Errorf("texts = %q", got)
+	}
+	if stats.Advanced != 3 || stats.Unsupported != 1 || stats.Invalid != 0 {
+		t.Errorf("stats = %+v, want 3 advanced and 1 unsupported", stats)
+	}
+}
+
+func TestBilibiliPositioned(t *testing.T) {
+	comments := parseBilibiliString(t, `<i>
+<d p="1,7,25,16777215,0,0,u,1">[0.25,0.5,"1-1",4.5,"比例坐标"]</d>
+<d p="2,7,25,16777215,0,0,u,2">["336","219","1-1","3","像素坐标"]</d>
+<d p="3,7,25,16777215,0,0,u,3">不是JSON</d>
+</i>`, DefaultOptions(25))
+
+	want := []Comment{
+		{Text: "比例坐标", X: 0.25, Y: 0.5, Duration: 4.5},
+		{Text: "像素坐标", X: 0.5, Y: 0.5, Duration: 3},
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("texts = %q, want 2 positioned comments", texts(comments))
+	}
+	for i, c := range comments {
+		w := want[i]
+		if c.Position != 4 || c.Text != w.Text || c.X != w.X || c.Y != w.Y || c.Duration != w.Duration {
+			t.Errorf("comment %d = %+v, want position 4 at (%v, %v) for %vs", i, c, w.X, w.Y, w.Duration)
+		}
+	}
+}
+
+func TestBilibiliHidden(t *testing.T) {
+	comments := parseFixture(t, "bilibili_hidden.xml", DefaultOptions(25))
+	var hidden []bool
+	for _, c := range comments {
+		hidden = append(hidden, c.Hidden)
+	}
+	if want := []bool{false, true, false, true}; !reflect.DeepEqual(hidden, want) {
+		t.Errorf("Hidden = %v, want %v", hidden, want)
+	}
+
+	kept := FilterComments(comments, NotHidden())
+	if got, want := texts(kept), []string{"正常弹幕", "未隐藏的弹幕"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NotHidden kept %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// CheckCharset 检查字符集名称是否受支持
+// 名称按WHATWG编码标准识别，如utf-8、shift_jis、gbk、gb18030、big5；空字符串表示UTF-8
+func CheckCharset(charset string) error {
+	if charset == "" {
+		return nil
+	}
+	if _, err := htmlindex.Get(charset); err != nil {
+		return fmt.Errorf("unsupported charset: %s", charset)
+	}
+	return nil
+}
+
+// decodeCharset 将按charset编码的输入转换为UTF-8
+// charset为空或为UTF-8时原样返回
+func decodeCharset(r io.Reader, charset string) (io.Reader, error) {
+	if charset == "" || isUTF8(charset) {
+		return r, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	return transform.NewReader(r, enc.NewDecoder()), nil
+}
+
+// newXMLDecoder 创建支持非UTF-8编码声明的XML解码器
+// 指定了opts.Charset时输入已被转换为UTF-8，忽略XML声明中的encoding；
+// 否则按声明中的encoding（如Shift_JIS）转换
+func newXMLDecoder(r io.Reader, opts Options) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if opts.Charset != "" {
+			return input, nil
+		}
+		return decodeCharset(input, label)
+	}
+	return decoder
+}
+
+// isUTF8 判断字符集名称是否表示UTF-8
+func isUTF8(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8":
+		return true
+	}
+	return false
+}
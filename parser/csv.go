@@ -0,0 +1,147 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// csvHeader CSV弹幕文件可选的表头
+const csvHeader = "time,position,color,size,text"
+
+// csvRecordPattern 匹配没有表头的CSV弹幕文件的第一行：时间和位置类型
+var csvRecordPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?,[0-9]*,`)
+
+// isCSV 判断文件开头是否为CSV弹幕：以表头或"时间,位置类型,"开始
+func isCSV(content string) bool {
+	line, _, _ := strings.Cut(content, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	if strings.HasPrefix(strings.ToLower(strings.ReplaceAll(line, " ", "")), csvHeader) {
+		return true
+	}
+	return csvRecordPattern.MatchString(line)
+}
+
+// parseCSV 解析CSV格式的弹幕文件，方便以程序生成弹幕
+// 每行依次为time,position,color,size,text，第一行可以是表头：
+//   - time: 出现时间（秒）
+//   - position: 位置类型，与Comment.Position相同：0=滚动，1=顶部，2=底部，3=逆向，为空时为0
+//   - color: 颜色，十进制或以#、0x开头的十六进制RRGGBB，为空时使用Options.DefaultColor
+//   - size: 字体大小，以25为标准大小（与B站相同），为空时为25
+//   - text: 弹幕内容，包含逗号、引号或换行时按CSV规则加双引号；未加引号的多余逗号视为内容的一部分
+//
+// 无法解析的行计入Stats.Invalid并跳过
+func parseCSV(r io.Reader, opts Options) ([]Comment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	reader.FieldsPerRecord = -1
+
+	var comments []Comment
+	for no := 0; ; no++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		// 跳过表头
+		if no == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "time") {
+			continue
+		}
+
+		comment, ok := newCSVComment(no, record, opts)
+		if !ok {
+			opts.Stats.addInvalid()
+			continue
+		}
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// newCSVComment 根据CSV的一行构造Comment，字段无法解析时返回false
+func newCSVComment(no int, record []string, opts Options) (Comment, bool) {
+	if len(record) < 5 {
+		return Comment{}, false
+	}
+	fields := make([]string, 4)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(record[i])
+	}
+
+	timeline, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Comment{}, false
+	}
+
+	position := 0
+	if fields[1] != "" {
+		// CSV没有坐标列，无法表示需要X/Y的定位弹幕(4)
+		if position, err = strconv.Atoi(fields[1]); err != nil || !KnownPosition(position) || position == 4 {
+			return Comment{}, false
+		}
+	}
+
+	color := opts.DefaultColor
+	if fields[2] != "" {
+		v, err := parseCSVColor(fields[2])
+		if err != nil {
+			return Comment{}, false
+		}
+		color = v
+	}
+
+	size := 25.0
+	if fields[3] != "" {
+		if size, err = strconv.ParseFloat(fields[3], 64); err != nil || size <= 0 {
+			return Comment{}, false
+		}
+	}
+
+	// 计算弹幕文本尺寸
+	textSize := size * opts.FontSize / 25.0
+	text := normalizeText(strings.Join(record[4:], ","), opts)
+	width, height := EstimateTextSize(text, textSize)
+
+	return Comment{
+		Timeline: timeline,
+		No:       no,
+		Text:     text,
+		Position: position,
+		Color:    color,
+		Size:     textSize,
+		Height:   height,
+		Width:    width,
+	}, true
+}
+
+// parseCSVColor 解析十进制或以#、0x开头的十六进制颜色
+func parseCSVColor(s string) (int, error) {
+	var v int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "#"):
+		v, err = strconv.ParseInt(s[1:], 16, 32)
+	case strings.HasPrefix(strings.ToLower(s), "0x"):
+		v, err = strconv.ParseInt(s[2:], 16, 32)
+	default:
+		v, err = strconv.ParseInt(s, 10, 32)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v > 0xFFFFFF {
+		return 0, fmt.Errorf("color out of range: %s", s)
+	}
+	return int(v), nil
+}
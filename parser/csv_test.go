@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	stats := &Stats{}
+	opts := DefaultOptions(25)
+	opts.Stats = stats
+	comments := parseFixture(t, "comments.csv", opts)
+
+	want := []string{"你好, 世界, 再见", "第一行\n第二行", `引号"内容"`, "未加引号,的逗号"}
+	if got := texts(comments); !reflect.DeepEqual(got, want) {
+		t.Errorf("texts = %q, want %q", got, want)
+	}
+	if stats.Invalid != 1 {
+		t.Errorf("invalid = %d, want 1", stats.Invalid)
+	}
+
+	for i, w := range []struct {
+		timeline float64
+		position int
+		color    int
+		size     float64
+	}{
+		{1.5, 0, 0xFF0000, 25},
+		{2, 1, 0xFFFFFF, 25},
+		{3, 2, 0xFF0000, 36},
+		{4, 0, 0x00FF00, 25},
+	} {
+		c := comments[i]
+		if c.Timeline != w.timeline || c.Position != w.position || c.Color != w.color || c.Size != w.size {
+			t.Errorf("comment %d = %+v, want %+v", i, c, w)
+		}
+	}
+	if comments[1].Height != 50 {
+		t.Errorf("two-line comment height = %v, want 50", comments[1].Height)
+	}
+}
+
+func TestParseCSVPosition(t *testing.T) {
+	stats := &Stats{}
+	opts := DefaultOptions(25)
+	opts.Stats = stats
+	comments, err := parseCSV(strings.NewReader("1,3,,,逆向\n2,4,,,定位\n3,5,,,未知\n"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 定位弹幕需要CSV没有的坐标，与未知位置一样视为无效行
+	if got := texts(comments); !reflect.DeepEqual(got, []string{"逆向"}) {
+		t.Errorf("texts = %q, want only the L2R comment", got)
+	}
+	if stats.Invalid != 2 {
+		t.Errorf("invalid = %d, want 2", stats.Invalid)
+	}
+}
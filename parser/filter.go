@@ -0,0 +1,147 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Predicate 弹幕过滤条件，返回true表示保留该弹幕
+type Predicate func(c Comment) bool
+
+// FilterComments 按过滤条件筛选弹幕
+// 结果复用输入切片的底层数组，多个过滤条件可以依次调用组合使用
+//
+// 参数：
+//   - comments: 要过滤的弹幕列表
+//   - keep: 过滤条件，返回true的弹幕会被保留
+//
+// 返回值：
+//   - []Comment: 过滤后的弹幕列表
+func FilterComments(comments []Comment, keep Predicate) []Comment {
+	filtered := comments[:0]
+	for _, c := range comments {
+		if keep(c) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// InPool 返回只保留指定弹幕池弹幕的过滤条件
+func InPool(pool int) Predicate {
+	return func(c Comment) bool {
+		return c.Pool == pool
+	}
+}
+
+// InTimeRange 返回按时间范围筛选弹幕的过滤条件
+// 时间范围为左闭右开区间[start, end)，end<=0表示不限制结束时间
+func InTimeRange(start, end float64) Predicate {
+	return func(c Comment) bool {
+		if c.Timeline < start {
+			return false
+		}
+		return end <= 0 || c.Timeline < end
+	}
+}
+
+// MaxLength 返回限制弹幕长度的过滤条件
+// 文本字符数（按rune计算）超过max的弹幕会被过滤掉
+func MaxLength(max int) Predicate {
+	return func(c Comment) bool {
+		return utf8.RuneCountInString(c.Text) <= max
+	}
+}
+
+// FixedOnly 返回只保留顶部和底部固定弹幕（位置类型1和2）的过滤条件
+func FixedOnly() Predicate {
+	return func(c Comment) bool {
+		return c.Position == 1 || c.Position == 2
+	}
+}
+
+// ScrollOnly 返回只保留滚动弹幕（位置类型0和3）的过滤条件
+func ScrollOnly() Predicate {
+	return func(c Comment) bool {
+		return c.Position == 0 || c.Position == 3
+	}
+}
+
+// NotBlank 返回过滤空白弹幕的过滤条件
+// 去除首尾空白后内容为空的弹幕会被过滤掉
+func NotBlank() Predicate {
+	return func(c Comment) bool {
+		return strings.TrimSpace(c.Text) != ""
+	}
+}
+
+// NotContaining 返回屏蔽关键词的过滤条件
+// 弹幕文本包含任意一个关键词（不区分大小写）时会被过滤掉
+func NotContaining(keywords []string) Predicate {
+	lowered := make([]string, 0, len(keywords))
+	for _, k := range keywords {
+		if k != "" {
+			lowered = append(lowered, strings.ToLower(k))
+		}
+	}
+	return func(c Comment) bool {
+		text := strings.ToLower(c.Text)
+		for _, k := range lowered {
+			if strings.Contains(text, k) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// NotMatching 返回屏蔽正则表达式的过滤条件
+// 弹幕文本匹配任意一个正则表达式时会被过滤掉
+func NotMatching(patterns []*regexp.Regexp) Predicate {
+	return func(c Comment) bool {
+		for _, re := range patterns {
+			if re.MatchString(c.Text) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// NotHidden 返回过滤在来源中被标记为隐藏的弹幕的过滤条件
+func NotHidden() Predicate {
+	return func(c Comment) bool {
+		return !c.Hidden
+	}
+}
+
+// FromUsers 返回只保留指定用户所发弹幕的过滤条件
+// 没有用户ID的弹幕（如A站弹幕）会被过滤掉
+func FromUsers(ids []string) Predicate {
+	set := userSet(ids)
+	return func(c Comment) bool {
+		return c.UserID != "" && set[c.UserID]
+	}
+}
+
+// NotFromUsers 返回屏蔽指定用户所发弹幕的过滤条件
+// 没有用户ID的弹幕会被保留
+func NotFromUsers(ids []string) Predicate {
+	set := userSet(ids)
+	return func(c Comment) bool {
+		return c.UserID == "" || !set[c.UserID]
+	}
+}
+
+// userSet 将用户ID列表转换为集合，忽略空白和空ID
+func userSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			set[id] = true
+		}
+	}
+	return set
+}
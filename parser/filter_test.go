@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestInPool(t *testing.T) {
+	comments := parseFixture(t, "bilibili_pools.xml", DefaultOptions(25))
+	if len(comments) != 5 {
+		t.Fatalf("parsed %d comments, want 5", len(comments))
+	}
+
+	got := texts(FilterComments(comments, InPool(0)))
+	want := []string{"普通弹幕", "底部弹幕"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pool 0 = %q, want %q", got, want)
+	}
+}
+
+func TestNotContaining(t *testing.T) {
+	comments := []Comment{
+		{Text: "前方高能"},
+		{Text: "SPOILER: he dies"},
+		{Text: "好看"},
+		{Text: "剧透预警"},
+	}
+
+	got := texts(FilterComments(comments, NotContaining([]string{"spoiler", "剧透", ""})))
+	want := []string{"前方高能", "好看"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNotMatching(t *testing.T) {
+	comments := []Comment{
+		{Text: "2333333"},
+		{Text: "第1名"},
+		{Text: "666"},
+		{Text: "12 34"},
+		{Text: "hello"},
+	}
+
+	patterns := []*regexp.Regexp{regexp.MustCompile(`^\d+$`), regexp.MustCompile(`^h`)}
+	got := texts(FilterComments(comments, NotMatching(patterns)))
+	want := []string{"第1名", "12 34"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInTimeRange(t *testing.T) {
+	comments := []Comment{
+		{Timeline: 9.99, Text: "before"},
+		{Timeline: 10, Text: "start"},
+		{Timeline: 15, Text: "middle"},
+		{Timeline: 19.99, Text: "last"},
+		{Timeline: 20, Text: "end"},
+	}
+
+	got := texts(FilterComments(append([]Comment(nil), comments...), InTimeRange(10, 20)))
+	want := []string{"start", "middle", "last"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("[10, 20) = %q, want %q", got, want)
+	}
+
+	// end<=0表示不限制结束时间
+	got = texts(FilterComments(append([]Comment(nil), comments...), InTimeRange(15, 0)))
+	want = []string{"middle", "last", "end"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("[15, ∞) = %q, want %q", got, want)
+	}
+}
+
+func TestFromUsers(t *testing.T) {
+	comments := parseNiconicoString(t, `<packet>
+<chat vpos="100" user_id="alice">一</chat>
+<chat vpos="200" user_id="bob">二</chat>
+<chat vpos="300" user_id="alice">三</chat>
+<chat vpos="400">匿名</chat>
+</packet>`, DefaultOptions(25))
+
+	if got, want := texts(FilterComments(append([]Comment(nil), comments...), FromUsers([]string{"alice"}))), []string{"一", "三"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("from alice = %q, want %q", got, want)
+	}
+	// 没有用户ID的弹幕不会被屏蔽
+	if got, want := texts(FilterComments(comments, NotFromUsers([]string{"alice"}))), []string{"二", "匿名"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("not from alice = %q, want %q", got, want)
+	}
+}
+
+func TestFixedOnlyScrollOnly(t *testing.T) {
+	comments := []Comment{
+		{Text: "滚动", Position: 0},
+		{Text: "顶部", Position: 1},
+		{Text: "底部", Position: 2},
+		{Text: "逆向", Position: 3},
+		{Text: "定位", Position: 4},
+	}
+
+	if got, want := texts(FilterComments(append([]Comment(nil), comments...), FixedOnly())), []string{"顶部", "底部"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FixedOnly = %q, want %q", got, want)
+	}
+	if got, want := texts(FilterComments(append([]Comment(nil), comments...), ScrollOnly())), []string{"滚动", "逆向"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScrollOnly = %q, want %q", got, want)
+	}
+}
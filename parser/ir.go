@@ -0,0 +1,53 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteJSON 将弹幕列表以JSON数组的形式写入w，作为统一的中间表示
+// 每条弹幕对应一个以Comment字段名为键的对象，便于检查解析结果或交给其他工具处理
+//
+// 参数：
+//   - w: 写入目标
+//   - comments: 要写入的弹幕列表
+//
+// 返回值：
+//   - error: 编码或写入失败时返回错误
+func WriteJSON(w io.Writer, comments []Comment) error {
+	if comments == nil {
+		comments = []Comment{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(comments)
+}
+
+// parseIR 解析WriteJSON输出的中间表示，用于读回经外部工具筛选或编辑后的弹幕
+// 弹幕的各字段原样保留；Size为0时使用基准字体大小，Width或Height为0时按文本重新估算
+func parseIR(r io.Reader, opts Options) ([]Comment, error) {
+	var comments []Comment
+	if err := decodeJSON(r, &comments); err != nil {
+		return nil, fmt.Errorf("invalid comment JSON: %w", err)
+	}
+
+	for i := range comments {
+		c := &comments[i]
+		if c.Size <= 0 {
+			c.Size = opts.FontSize
+		}
+		if c.Width <= 0 || c.Height <= 0 {
+			w, h := EstimateTextSize(c.Text, c.Size)
+			if c.Width <= 0 {
+				c.Width = w
+			}
+			if c.Height <= 0 {
+				c.Height = h
+			}
+		}
+	}
+	return comments, nil
+}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIRBoldItalic(t *testing.T) {
+	comments, err := parseIR(strings.NewReader(`[
+  {"Timeline": 1, "Text": "粗体", "Bold": true},
+  {"Timeline": 2, "Text": "斜体", "Italic": true}
+]`), DefaultOptions(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comments[0].Bold || comments[0].Italic || comments[1].Bold || !comments[1].Italic {
+		t.Errorf("comments = %+v", comments)
+	}
+}
+
+func TestParseIROutlineColor(t *testing.T) {
+	comments, err := parseIR(strings.NewReader(`[
+  {"Timeline": 1, "Text": "红边", "OutlineColor": 16711680},
+  {"Timeline": 2, "Text": "默认描边"}
+]`), DefaultOptions(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments[0].OutlineColor != 0xFF0000 || comments[1].OutlineColor != 0 {
+		t.Errorf("outline colors = %06X, %06X, want FF0000, 000000", comments[0].OutlineColor, comments[1].OutlineColor)
+	}
+}
+
+func TestWriteJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{"bilibili_pools.xml", "niconico_sizes.xml", "bilibili.json"} {
+		comments := parseFixture(t, name, DefaultOptions(25))
+
+		var b bytes.Buffer
+		if err := WriteJSON(&b, comments); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range []string{`"Timeline"`, `"Position"`, `"Color"`, `"Size"`, `"Text"`} {
+			if !strings.Contains(b.String(), field) {
+				t.Errorf("%s: JSON does not contain %s", name, field)
+			}
+		}
+
+		back, err := parseIR(&b, DefaultOptions(25))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back, comments) {
+			t.Errorf("%s: round trip gave\n%+v\nwant\n%+v", name, back, comments)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// utf8BOM UTF-8字节序标记
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// decodeJSON 读取r中的全部内容并解码到v
+// 容忍开头的BOM和数组、对象末尾多余的逗号（替换为空格以保持偏移不变），
+// 解码失败时返回的错误包含出错位置的行号、列号和字节偏移
+func decodeJSON(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if bytes.HasPrefix(data, utf8BOM) {
+		copy(data, "   ")
+	}
+	blankTrailingCommas(data)
+
+	if err := json.Unmarshal(data, v); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var offset int64
+		switch {
+		case errors.As(err, &syntaxErr):
+			offset = syntaxErr.Offset
+		case errors.As(err, &typeErr):
+			offset = typeErr.Offset
+		default:
+			return err
+		}
+		line, column := lineColumn(data, offset)
+		return fmt.Errorf("line %d, column %d (byte offset %d): %w", line, column, offset, err)
+	}
+	return nil
+}
+
+// blankTrailingCommas 将紧跟在]或}之前（中间只有空白）的逗号替换为空格
+// 字符串中的逗号不受影响
+func blankTrailingCommas(data []byte) {
+	inString := false
+	escaped := false
+	comma := -1
+	for i, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch b {
+		case '"':
+			inString = true
+			comma = -1
+		case ',':
+			comma = i
+		case ']', '}':
+			if comma >= 0 {
+				data[comma] = ' '
+			}
+			comma = -1
+		case ' ', '\t', '\r', '\n':
+		default:
+			comma = -1
+		}
+	}
+}
+
+// lineColumn 计算字节偏移对应的行号和列号（均从1开始，列号按字节计算）
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, column := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
@@ -4,7 +4,8 @@ package parser
 import (
 	"encoding/xml"
 	"fmt"
-	"os"
+	"io"
+	"strconv"
 	"strings"
 )
 
@@ -13,7 +14,7 @@ import (
 // <chat vpos="100" no="1" date="1234567890" user_id="user1" mail="184">弹幕内容</chat>
 type NiconicoComment struct {
 	XMLName xml.Name `xml:"chat"`         // XML标签名为chat
-	VPos    int      `xml:"vpos,attr"`    // 视频位置（1/100秒）
+	VPos    int64    `xml:"vpos,attr"`    // 视频位置（1/100秒），长时间直播录像的值可能很大
 	No      int      `xml:"no,attr"`      // 弹幕序号
 	Date    int64    `xml:"date,attr"`    // 发送时间戳
 	UserID  string   `xml:"user_id,attr"` // 用户ID
@@ -22,6 +23,7 @@ type NiconicoComment struct {
 }
 
 // NiconicoXML 表示N站弹幕文件的根XML结构
+// 实际文件的根节点和其他元素（如thread）可能不同，解析时只提取chat元素
 type NiconicoXML struct {
 	XMLName  xml.Name          `xml:"packet"` // 根节点标签名为packet
 	Comments []NiconicoComment `xml:"chat"`   // 所有弹幕评论
@@ -31,49 +33,79 @@ type NiconicoXML struct {
 // N站弹幕使用XML格式，每条弹幕包含位置、颜色等命令信息
 //
 // mail属性包含以空格分隔的命令，常见命令：
+// - naka: 滚动弹幕（默认）
 // - ue: 顶部固定弹幕
 // - shita: 底部固定弹幕
-// - big: 大号字体
-// - small: 小号字体
-// - 颜色值: 6位16进制颜色值
-func parseNiconico(file *os.File, fontSize float64) ([]Comment, error) {
-	var nicoXML NiconicoXML
-	if err := xml.NewDecoder(file).Decode(&nicoXML); err != nil {
-		return nil, err
+// - big: 大号字体（按opts.BigScale缩放）
+// - medium: 标准字体（默认）
+// - small: 小号字体（按opts.SmallScale缩放）
+// - defont: 默认字体
+// - gothic/mincho: 黑体/明朝体字体
+// - full: 全屏显示（不支持，忽略）
+// - @N: 显示N秒（可以是小数）
+// - 184: 匿名发送（不影响显示，忽略）
+// - _live: 直播中发送的弹幕（忽略）
+// - 颜色值: 6位16进制颜色值，可以带#前缀
+// 无法识别的命令会被忽略
+func parseNiconico(r io.Reader, opts Options) ([]Comment, error) {
+	chats, err := decodeNiconicoChats(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Niconico XML: %w", err)
 	}
 
-	comments := make([]Comment, 0, len(nicoXML.Comments))
-	for _, c := range nicoXML.Comments {
+	comments := make([]Comment, 0, len(chats))
+	for _, c := range chats {
 		// 解析mail命令
 		var position int
 		var color int = 0xFFFFFF // 默认颜色为白色
-		var size float64 = fontSize
+		var size float64 = opts.FontSize
+		var fontName string  // 空字符串表示使用默认字体
+		var duration float64 // 0表示使用默认时长
 
-		commands := strings.Split(c.Mail, " ")
-		for _, cmd := range commands {
+		for _, cmd := range strings.Fields(c.Mail) {
 			switch cmd {
+			case "naka":
+				position = 0 // 滚动
 			case "ue":
 				position = 1 // 顶部固定
 			case "shita":
 				position = 2 // 底部固定
 			case "big":
-				size = fontSize * 1.5 // 1.5倍字体大小
+				size = opts.FontSize * opts.BigScale // 放大字体
+			case "medium":
+				size = opts.FontSize // 标准字体
 			case "small":
-				size = fontSize * 0.5 // 0.5倍字体大小
+				size = opts.FontSize * opts.SmallScale // 缩小字体
+			case "defont":
+				fontName = "" // 默认字体
+			case "gothic":
+				fontName = "MS PGothic" // 黑体
+			case "mincho":
+				fontName = "MS PMincho" // 明朝体
+			case "full", "184", "_live":
+				// 全屏显示不支持，匿名和直播标记不影响显示，忽略
 			default:
-				// 尝试解析颜色值
-				if len(cmd) == 6 {
-					if _, err := fmt.Sscanf(cmd, "%x", &color); err == nil {
-						continue
+				// @N指定显示时长（秒）
+				if strings.HasPrefix(cmd, "@") {
+					if v, err := strconv.ParseFloat(cmd[1:], 64); err == nil && v > 0 {
+						duration = v
+					}
+					continue
+				}
+
+				// 尝试解析颜色值，只接受6位十六进制字符（可以带#前缀），避免其他命令被误判为颜色
+				hex := strings.TrimPrefix(cmd, "#")
+				if len(hex) == 6 && isHex(hex) {
+					if v, err := strconv.ParseInt(hex, 16, 32); err == nil {
+						color = int(v)
 					}
 				}
 			}
 		}
 
 		// Calculate text dimensions
-		text := strings.Replace(c.Content, "/n", "\n", -1)
-		height := float64(strings.Count(text, "\n")+1) * size
-		width := calculateLength(text) * size
+		text := normalizeText(c.Content, opts)
+		width, height := EstimateTextSize(text, size)
 
 		// Convert vpos (1/100 seconds) to timeline (seconds)
 		timeline := float64(c.VPos) / 100.0
@@ -88,8 +120,56 @@ func parseNiconico(file *os.File, fontSize float64) ([]Comment, error) {
 			Size:      size,
 			Height:    height,
 			Width:     width,
+			FontName:  fontName,
+			Duration:  duration,
+			UserID:    c.UserID,
 		})
 	}
 
 	return comments, nil
 }
+
+// decodeNiconicoChats 从XML中提取所有chat元素
+// 不要求根节点为packet，thread等其他元素会被忽略，chat可以出现在任意层级
+// 多个XML文档直接拼接时会一直读取到EOF
+func decodeNiconicoChats(r io.Reader, opts Options) ([]NiconicoComment, error) {
+	var chats []NiconicoComment
+	var hasRoot bool
+	decoder := newXMLDecoder(r, opts)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF && hasRoot {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		hasRoot = true
+		if start.Name.Local != "chat" {
+			continue
+		}
+
+		var c NiconicoComment
+		if err := decoder.DecodeElement(&c, &start); err != nil {
+			return nil, err
+		}
+		chats = append(chats, c)
+	}
+
+	return chats, nil
+}
+
+// isHex 判断字符串是否全部由十六进制字符组成
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return s != ""
+}
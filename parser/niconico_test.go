@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNiconicoSizeScale(t *testing.T) {
+	opts := DefaultOptions(40)
+	opts.BigScale = 2
+	opts.SmallScale = 0.25
+	comments := parseFixture(t, "niconico_sizes.xml", opts)
+
+	want := []float64{40, 80, 10}
+	for i, c := range comments {
+		if c.Size != want[i] {
+			t.Errorf("%s size = %v, want %v", c.Text, c.Size, want[i])
+		}
+	}
+
+	// ParseComments使用默认的1.5倍
+	file, err := os.Open("../test/niconico_sizes.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	comments, err = ParseComments(file, FormatNiconico, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments[1].Size != 60 {
+		t.Errorf("default big size = %v, want 60", comments[1].Size)
+	}
+}
+
+// parseNiconicoString 解析字符串形式的N站弹幕
+func parseNiconicoString(t *testing.T, xml string, opts Options) []Comment {
+	t.Helper()
+	comments, err := parseNiconico(strings.NewReader(xml), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comments
+}
+
+func TestNiconicoFont(t *testing.T) {
+	comments := parseNiconicoString(t, `<packet>
+<chat vpos="0" mail="mincho">明朝</chat>
+<chat vpos="0" mail="gothic">ゴシック</chat>
+<chat vpos="0" mail="mincho defont">標準</chat>
+</packet>`, DefaultOptions(25))
+
+	want := []string{"MS PMincho", "MS PGothic", ""}
+	for i, c := range comments {
+		if c.FontName != want[i] {
+			t.Errorf("%s FontName = %q, want %q", c.Text, c.FontName, want[i])
+		}
+	}
+}
+
+func TestNiconicoMailCommands(t *testing.T) {
+	comments := parseNiconicoString(t, `<packet>
+<chat vpos="0" mail="ue big 123abc">色付き</chat>
+<chat vpos="0" mail="ue mincho">明朝</chat>
+</packet>`, DefaultOptions(20))
+
+	c := comments[0]
+	if c.Position != 1 || c.Size != 30 || c.Color != 0x123ABC {
+		t.Errorf("ue big 123abc: position %d, size %v, color %06X", c.Position, c.Size, c.Color)
+	}
+	if c := comments[1]; c.Color != 0xFFFFFF || c.FontName != "MS PMincho" {
+		t.Errorf("ue mincho: color %06X, font %q", c.Color, c.FontName)
+	}
+}
+
+func TestNiconicoColorFalsePositive(t *testing.T) {
+	comments := parseNiconicoString(t, `<packet>
+<chat vpos="0" mail="foobar">foobar</chat>
+<chat vpos="0" mail="deadbeef">8文字</chat>
+<chat vpos="0" mail="#ff0000">赤</chat>
+</packet>`, DefaultOptions(25))
+
+	want := []int{0xFFFFFF, 0xFFFFFF, 0xFF0000}
+	for i, c := range comments {
+		if c.Color != want[i] {
+			t.Errorf("%s color = %06X, want %06X", c.Text, c.Color, want[i])
+		}
+	}
+}
+
+func TestNiconicoLargeVPos(t *testing.T) {
+	// 超过int32范围的vpos（约497天的直播录像）
+	comments := parseNiconicoString(t, `<packet>
+<chat vpos="4294967296" mail="">长时间直播</chat>
+<chat vpos="360000" mail="@2.5">一小时</chat>
+</packet>`, DefaultOptions(25))
+
+	if len(comments) != 2 {
+		t.Fatalf("parsed %d comments, want 2", len(comments))
+	}
+	if got := comments[0].Timeline; got != 42949672.96 {
+		t.Errorf("large vpos timeline = %v, want 42949672.96", got)
+	}
+	if c := comments[1]; c.Timeline != 3600 || c.Duration != 2.5 {
+		t.Errorf("@2.5 comment: timeline %v, duration %v, want 3600, 2.5", c.Timeline, c.Duration)
+	}
+}
+
+func TestNiconicoShiftJIS(t *testing.T) {
+	opts := DefaultOptions(25)
+	opts.Charset = "shift_jis"
+	comments := parseFixture(t, "niconico_shift_jis.xml", opts)
+	if got := texts(comments); !reflect.DeepEqual(got, []string{"こんにちは", "弾幕テスト"}) {
+		t.Errorf("texts = %q", got)
+	}
+
+	// 不指定字符集时使用XML声明中的encoding
+	data, err := os.ReadFile("../test/niconico_shift_jis.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared := `<?xml version="1.0" encoding="Shift_JIS"?>` + "\n" + string(data)
+	comments = parseNiconicoString(t, declared, DefaultOptions(25))
+	if got := texts(comments); !reflect.DeepEqual(got, []string{"こんにちは", "弾幕テスト"}) {
+		t.Errorf("declared encoding: texts = %q", got)
+	}
+}
+
+func TestNiconicoAnonymousNaka(t *testing.T) {
+	comments := parseNiconicoString(t, `<packet>
+<chat vpos="0" mail="184 naka">匿名滚动</chat>
+<chat vpos="0" mail="184 shita ff0000">匿名底部</chat>
+</packet>`, DefaultOptions(25))
+
+	if len(comments) != 2 {
+		t.Fatalf("parsed %d comments, want 2", len(comments))
+	}
+	if c := comments[0]; c.Position != 0 || c.Color != 0xFFFFFF || c.Size != 25 {
+		t.Errorf("184 naka: position %d, color %06X, size %v", c.Position, c.Color, c.Size)
+	}
+	if c := comments[1]; c.Position != 2 || c.Color != 0xFF0000 {
+		t.Errorf("184 shita ff0000: position %d, color %06X", c.Position, c.Color)
+	}
+}
+
+func TestNiconicoKeepSlashN(t *testing.T) {
+	// 默认将"/n"转换为换行，网址中的/n也会被转换
+	comments := parseFixture(t, "niconico_url.xml", DefaultOptions(25))
+	if got, want := texts(comments), []string{"見て https://example.com\news\n123", "一行目\n二行目"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default: texts = %q, want %q", got, want)
+	}
+
+	opts := DefaultOptions(25)
+	opts.KeepSlashN = []Format{FormatNiconico}
+	comments = parseFixture(t, "niconico_url.xml", opts)
+	if got, want := texts(comments), []string{"見て https://example.com/news/n123", "一行目/n二行目"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("KeepSlashN: texts = %q, want %q", got, want)
+	}
+	if comments[0].Height != 25 {
+		t.Errorf("KeepSlashN: URL comment height = %v, want one line", comments[0].Height)
+	}
+
+	// 只对列出的格式生效
+	opts.KeepSlashN = []Format{FormatBilibili}
+	comments = parseFixture(t, "niconico_url.xml", opts)
+	if got := comments[1].Text; got != "一行目\n二行目" {
+		t.Errorf("KeepSlashN for Bilibili only: text = %q", got)
+	}
+}
+
+func TestNiconicoThreadHeader(t *testing.T) {
+	comments := parseFixture(t, "niconico_thread.xml", DefaultOptions(25))
+	want := []struct {
+		timeline float64
+		text     string
+	}{
+		{1.5, "最初のコメント"},
+		{3.25, "上に赤"},
+		{60, "一分後"},
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("got %d comments (%q), want %d", len(comments), texts(comments), len(want))
+	}
+	for i, c := range comments {
+		if c.Timeline != want[i].timeline || c.Text != want[i].text {
+			t.Errorf("comment %d = %v %q, want %v %q", i, c.Timeline, c.Text, want[i].timeline, want[i].text)
+		}
+	}
+}
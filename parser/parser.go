@@ -4,24 +4,47 @@
 package parser
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
 )
 
 // Comment 表示单条弹幕的结构体
 // 包含弹幕的所有基本属性，如显示时间、位置、颜色等
 type Comment struct {
-	Timeline  float64 // 弹幕在视频中的显示时间点（秒）
-	Timestamp int64   // 弹幕发送时的UNIX时间戳
-	No        int     // 弹幕的序号
-	Text      string  // 弹幕文本内容
-	Position  int     // 弹幕位置类型：0=滚动弹幕，1=顶部固定，2=底部固定，3=逆向滚动
-	Color     int     // 弹幕颜色，格式为0xRRGGBB
-	Size      float64 // 弹幕字体大小
-	Height    float64 // 弹幕预估高度（像素）
-	Width     float64 // 弹幕预估宽度（像素）
+	Timeline     float64 // 弹幕在视频中的显示时间点（秒）
+	Timestamp    int64   // 弹幕发送时的UNIX时间戳
+	No           int     // 弹幕的序号
+	Text         string  // 弹幕文本内容
+	Position     int     // 弹幕位置类型：0=滚动弹幕，1=顶部固定，2=底部固定，3=逆向滚动，4=定位弹幕
+	Color        int     // 弹幕颜色，格式为0xRRGGBB
+	Size         float64 // 弹幕字体大小
+	Height       float64 // 弹幕预估高度（像素）
+	Width        float64 // 弹幕预估宽度（像素）
+	Pool         int     // 弹幕池（仅B站）：0=普通池，1=字幕池，2=特殊池
+	FontName     string  // 弹幕字体名称，为空时使用默认字体
+	Bold         bool    // 是否粗体；各平台的弹幕格式都没有粗体标记，只有中间表示(IR)和库的调用方会设置
+	Italic       bool    // 是否斜体；与Bold相同，只有中间表示(IR)和库的调用方会设置
+	Duration     float64 // 弹幕自带的显示时长（秒），0表示使用生成器的默认时长
+	UserID       string  // 发送者的用户ID（B站为用户ID的哈希），格式不提供时为空
+	Alpha        int     // 弹幕自带的不透明度(1-255，255为不透明)，0表示使用样式的透明度
+	Hidden       bool    // 弹幕在来源中被标记为隐藏（已被举报或屏蔽）
+	X            float64 // 定位弹幕左上角的横坐标，为屏幕宽度的比例(0-1)
+	Y            float64 // 定位弹幕左上角的纵坐标，为屏幕高度的比例(0-1)
+	OutlineColor int     // 描边颜色(0xRRGGBB)，0表示使用样式的黑色描边；目前只有中间表示(IR)会携带
+}
+
+// KnownPosition 判断弹幕位置类型是否在Comment.Position已知的0-4范围内
+func KnownPosition(position int) bool {
+	return position >= 0 && position <= 4
 }
 
 // Format 表示弹幕文件的格式类型
@@ -29,21 +52,165 @@ type Format string
 
 // 支持的弹幕格式常量定义
 const (
-	FormatBilibili Format = "Bilibili" // B站弹幕格式
-	FormatNiconico Format = "Niconico" // N站弹幕格式
-	FormatAcfun    Format = "Acfun"    // A站弹幕格式
+	FormatBilibili     Format = "Bilibili"     // B站弹幕格式
+	FormatNiconico     Format = "Niconico"     // N站弹幕格式
+	FormatAcfun        Format = "Acfun"        // A站弹幕格式
+	FormatBilibiliJSON Format = "BilibiliJSON" // B站JSON弹幕格式（第三方工具导出）
+	FormatIR           Format = "IR"           // 本程序以-t json输出的弹幕中间表示
+	FormatCSV          Format = "CSV"          // 以程序生成的CSV弹幕(time,position,color,size,text)
+)
+
+// formats 所有支持的弹幕格式
+var formats = []Format{FormatBilibili, FormatNiconico, FormatAcfun, FormatBilibiliJSON, FormatIR, FormatCSV}
+
+// Formats 返回所有支持的弹幕格式，包括通过RegisterParser注册的格式
+func Formats() []Format {
+	all := append([]Format(nil), formats...)
+
+	customMu.RLock()
+	defer customMu.RUnlock()
+	for _, p := range customParsers {
+		all = append(all, p.format)
+	}
+	return all
+}
+
+// LookupFormat 按名称查找弹幕格式（包括通过RegisterParser注册的格式），不区分大小写
+func LookupFormat(name string) (Format, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	return lookupFormatLocked(name)
+}
+
+// lookupFormatLocked 与LookupFormat相同，调用方必须持有customMu
+func lookupFormatLocked(name string) (Format, bool) {
+	for _, f := range formats {
+		if strings.EqualFold(string(f), name) {
+			return f, true
+		}
+	}
+	for _, p := range customParsers {
+		if strings.EqualFold(string(p.format), name) {
+			return p.format, true
+		}
+	}
+	return "", false
+}
+
+// ProbeFormat可能返回的错误，调用方可以使用errors.Is判断
+var (
+	// ErrEmptyInput 表示输入内容为空
+	ErrEmptyInput = errors.New("empty input")
+	// ErrUnknownFormat 表示无法识别输入内容的格式
+	ErrUnknownFormat = errors.New("unknown format")
+)
+
+// TimeUnit 表示B站XML弹幕时间字段的单位
+// 部分第三方导出工具以毫秒而不是秒记录弹幕出现时间
+type TimeUnit int
+
+// 支持的时间单位
+const (
+	TimeUnitSeconds      TimeUnit = iota // 秒（B站官方格式）
+	TimeUnitMilliseconds                 // 毫秒
+	TimeUnitAuto                         // 自动检测：文件中存在超过AutoMillisecondsThreshold的时间时按毫秒处理
 )
 
+// AutoMillisecondsThreshold 自动检测时间单位时判定为毫秒的阈值（秒）
+// 正常视频和直播录像的弹幕时间不会超过24小时
+const AutoMillisecondsThreshold = 24 * 60 * 60
+
+// ScaleMap 按弹幕格式指定的缩放倍数
+type ScaleMap map[Format]float64
+
+// Options 控制弹幕解析行为的选项
+// 各格式的标准大小弹幕（B站和A站size为25，N站medium）解析后的字号都等于FontSize，
+// 不同来源的弹幕视觉大小仍有差异时可以用FormatScale按格式微调
+type Options struct {
+	FontSize     float64  // 基准字体大小，用于计算弹幕实际显示大小
+	BigScale     float64  // N站big命令的字体缩放倍数
+	SmallScale   float64  // N站small命令的字体缩放倍数
+	DefaultColor int      // B站弹幕颜色缺失或为0时使用的颜色(0xRRGGBB)
+	Trim         bool     // 去除弹幕文本首尾的空白字符
+	TimeUnit     TimeUnit // B站XML弹幕时间字段的单位
+	AcfunSize    SizeMode // A站弹幕size字段的含义
+	FormatScale  ScaleMap // 各格式弹幕尺寸的额外缩放倍数，未指定的格式为1
+	Charset      string   // 输入文件的字符集，如shift_jis、gbk，为空表示UTF-8
+	Fast         bool     // B站XML使用直接扫描代替encoding/xml，结果相同但更快
+	KeepSlashN   []Format // 这些格式的弹幕中"/n"保留为普通字符，不转换为换行
+	Stats        *Stats   // 可选的统计信息收集器，为nil时不统计
+
+	literalSlash bool // 由ParseCommentsContext根据KeepSlashN和文件格式设置
+}
+
+// Stats 记录解析过程中的统计信息
+// 同一个Stats可以在多次解析间共享以累计统计结果
+type Stats struct {
+	Parsed      map[Format]int // 各格式成功解析的弹幕数
+	Invalid     int            // 因属性无法解析而跳过的弹幕数
+	Unsupported int            // 因弹幕模式不受支持而跳过的弹幕数
+	Advanced    int            // 跳过的B站高级弹幕数（模式7/8/9，内容为脚本或定位数据）
+}
+
+// addParsed 累计指定格式成功解析的弹幕数，s为nil时不做任何事
+func (s *Stats) addParsed(format Format, n int) {
+	if s == nil {
+		return
+	}
+	if s.Parsed == nil {
+		s.Parsed = make(map[Format]int)
+	}
+	s.Parsed[format] += n
+}
+
+// addAdvanced 累计跳过的高级弹幕数，s为nil时不做任何事
+func (s *Stats) addAdvanced() {
+	if s != nil {
+		s.Advanced++
+	}
+}
+
+// addInvalid 累计无法解析的弹幕数，s为nil时不做任何事
+func (s *Stats) addInvalid() {
+	if s != nil {
+		s.Invalid++
+	}
+}
+
+// addUnsupported 累计模式不受支持的弹幕数，s为nil时不做任何事
+func (s *Stats) addUnsupported() {
+	if s != nil {
+		s.Unsupported++
+	}
+}
+
+// DefaultOptions 返回指定基准字体大小下的默认解析选项
+func DefaultOptions(fontSize float64) Options {
+	return Options{
+		FontSize:     fontSize,
+		BigScale:     1.5,
+		SmallScale:   0.5,
+		DefaultColor: 0xFFFFFF,
+		AcfunSize:    SizeAuto,
+	}
+}
+
+// probeSize 检测格式时读取的文件开头字节数
+// XML文件的声明、注释、DOCTYPE等序言可能很长，因此读取足够大的范围以包含根节点
+const probeSize = 4096
+
 // ProbeFormat 检测弹幕文件的格式类型
-// 通过读取文件开头的内容来判断是哪种弹幕格式
-// 支持检测Bilibili(XML格式)、Niconico(XML格式)和AcFun(JSON格式)三种格式
+// 通过读取文件开头的内容来判断是哪种弹幕格式，检测后文件位置恢复原状
+// 支持检测Bilibili(XML/JSON格式)、Niconico(XML格式)、AcFun(JSON格式)、CSV格式、本程序输出的JSON中间表示，
+// 以及通过RegisterParser注册的格式
 //
 // 参数：
 //   - file: 要检测格式的弹幕文件
 //
 // 返回值：
 //   - Format: 检测到的弹幕格式
-//   - error: 如果发生错误或无法识别格式则返回错误
+//   - error: 读取失败时返回读取错误；文件为空时返回ErrEmptyInput；
+//     无法识别格式时返回包装了ErrUnknownFormat的错误，其中附带文件开头的字节
 func ProbeFormat(file *os.File) (Format, error) {
 	// 保存当前文件位置
 	curPos, err := file.Seek(0, io.SeekCurrent)
@@ -52,31 +219,107 @@ func ProbeFormat(file *os.File) (Format, error) {
 	}
 	defer file.Seek(curPos, io.SeekStart)
 
-	// 读取文件开头部分用于判断格式
-	buf := make([]byte, 100)
-	n, err := file.Read(buf)
-	if err != nil && err != io.EOF {
-		return "", err
+	format, _, err := ProbeFormatReader(file)
+	return format, err
+}
+
+// ProbeFormatReader 与ProbeFormat相同，但适用于无法Seek的输入，如网络流和标准输入
+// 使用bufio.Reader预读开头的内容，返回的读取器仍会从头产生包括预读部分在内的全部内容，
+// 之后应从返回的读取器而不是r读取，例如交给ParseCommentsReader解析
+//
+// 参数：
+//   - r: 要检测格式的输入
+//
+// 返回值：
+//   - Format: 检测到的弹幕格式
+//   - io.Reader: 包含全部输入内容的读取器，出错时也不为nil
+//   - error: 与ProbeFormat相同
+func ProbeFormatReader(r io.Reader) (Format, io.Reader, error) {
+	br := bufio.NewReaderSize(r, probeSize)
+
+	// 预读开头部分用于判断格式
+	buf, err := br.Peek(probeSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", br, err
+	}
+	format, err := probeContent(buf)
+	return format, br, err
+}
+
+// probeContent 根据文件开头的内容判断弹幕格式
+func probeContent(buf []byte) (Format, error) {
+	if len(buf) == 0 {
+		return "", ErrEmptyInput
+	}
+
+	// 先检测通过RegisterParser注册的格式
+	if format, ok := probeCustom(buf); ok {
+		return format, nil
 	}
 
-	content := string(buf[:n])
+	// 忽略开头的UTF-8 BOM
+	content := strings.TrimPrefix(string(buf), "\ufeff")
 
 	// 根据文件内容特征判断格式
-	if strings.HasPrefix(content, "<?xml") {
-		if strings.Contains(content, "<i>") {
-			return FormatBilibili, nil // B站XML格式
-		} else if strings.Contains(content, "<chat>") {
-			return FormatNiconico, nil // N站XML格式
+	if strings.HasPrefix(strings.TrimSpace(content), "<") {
+		if format, ok := probeXML(content); ok {
+			return format, nil
 		}
 	} else if strings.HasPrefix(content, "[") {
+		// 中间表示使用Comment的字段名作为键，A站和B站的JSON都没有Timeline键
+		if strings.Contains(content, `"Timeline"`) {
+			return FormatIR, nil // 中间表示
+		}
+		// B站JSON导出使用c/m键或progress键，其余JSON数组视为A站格式；
+		// A站也有使用c/m键的形式，按c字段的内容区分
+		if isAcfunC(content) {
+			return FormatAcfun, nil // A站c字段形式
+		}
+		if strings.Contains(content, `"c"`) || strings.Contains(content, `"progress"`) {
+			return FormatBilibiliJSON, nil // B站JSON格式
+		}
 		return FormatAcfun, nil // A站JSON格式
+	} else if isCSV(content) {
+		return FormatCSV, nil // CSV格式
 	}
 
-	return "", fmt.Errorf("unknown format")
+	// 附带文件开头的若干字节，便于排查
+	head := buf
+	if len(head) > 16 {
+		head = head[:16]
+	}
+	return "", fmt.Errorf("%w (first bytes: % x)", ErrUnknownFormat, head)
+}
+
+// xmlTags 区分XML弹幕格式的标签，属性可能紧跟标签名，因此分别匹配">"和空格结尾的形式
+var xmlTags = []struct {
+	tag    string
+	format Format
+}{
+	{"<i>", FormatBilibili},
+	{"<i ", FormatBilibili},
+	{"<d ", FormatBilibili},
+	{"<packet>", FormatNiconico},
+	{"<packet ", FormatNiconico},
+	{"<chat>", FormatNiconico},
+	{"<chat ", FormatNiconico},
+}
+
+// probeXML 在XML文件开头的内容中查找区分格式的标签
+// 标签可以出现在范围内的任意位置（如较长的序言之后），以最先出现的标签为准
+func probeXML(content string) (Format, bool) {
+	var format Format
+	first := -1
+	for _, t := range xmlTags {
+		if i := strings.Index(content, t.tag); i >= 0 && (first < 0 || i < first) {
+			first, format = i, t.format
+		}
+	}
+	return format, first >= 0
 }
 
 // ParseComments 解析弹幕文件中的所有弹幕
-// 根据指定的格式类型调用相应的解析函数
+// 根据指定的格式类型调用相应的解析函数，其余解析选项使用DefaultOptions的默认值
 //
 // 参数：
 //   - file: 要解析的弹幕文件
@@ -85,26 +328,186 @@ func ProbeFormat(file *os.File) (Format, error) {
 //
 // 返回值：
 //   - []Comment: 解析出的所有弹幕列表
-//   - error: 如果解析过程中发生错误则返回错误
+//   - error: 如果解析过程中发生错误则返回错误，错误信息包含文件名和格式
 func ParseComments(file *os.File, format Format, fontSize float64) ([]Comment, error) {
+	return ParseCommentsOptions(file, format, DefaultOptions(fontSize))
+}
+
+// ParseCommentsOptions 与ParseComments相同，但使用opts指定的解析选项
+func ParseCommentsOptions(file *os.File, format Format, opts Options) ([]Comment, error) {
+	return ParseCommentsContext(context.Background(), file, format, opts)
+}
+
+// ParseCommentsContext 与ParseCommentsOptions相同，但可以通过ctx取消解析
+// 每次从文件读取数据前都会检查ctx，取消后尽快返回ctx.Err()
+func ParseCommentsContext(ctx context.Context, file *os.File, format Format, opts Options) ([]Comment, error) {
+	return ParseCommentsReader(ctx, file, file.Name(), format, opts)
+}
+
+// ParseCommentsReader 与ParseCommentsContext相同，但从任意读取器解析，适用于标准输入、网络流和内存中的数据
+// 通常先用ProbeFormatReader检测格式，再从它返回的读取器解析
+//
+// 参数：
+//   - ctx: 用于取消解析的上下文
+//   - r: 弹幕数据
+//   - name: 输入的名称，用于错误信息
+//   - format: 弹幕数据的格式类型
+//   - opts: 解析选项
+//
+// 返回值：
+//   - []Comment: 解析出的所有弹幕列表
+//   - error: 解析出错或被取消时返回错误，错误信息包含name和格式
+func ParseCommentsReader(ctx context.Context, r io.Reader, name string, format Format, opts Options) ([]Comment, error) {
+	var parse func(io.Reader, Options) ([]Comment, error)
 	switch format {
 	case FormatBilibili:
-		return parseBilibili(file, fontSize)
+		parse = parseBilibili
 	case FormatNiconico:
-		return parseNiconico(file, fontSize)
+		parse = parseNiconico
 	case FormatAcfun:
-		return parseAcfun(file, fontSize)
+		parse = parseAcfun
+	case FormatBilibiliJSON:
+		parse = parseBilibiliJSON
+	case FormatIR:
+		parse = parseIR
+	case FormatCSV:
+		parse = parseCSV
 	default:
-		return nil, fmt.Errorf("unsupported format: %s", format)
+		custom, ok := findCustom(format)
+		if !ok {
+			return nil, fmt.Errorf("unsupported format: %s", format)
+		}
+		parse = func(r io.Reader, opts Options) ([]Comment, error) {
+			return custom.parse(r, opts.FontSize)
+		}
+	}
+
+	// 非UTF-8输入先转换为UTF-8再解析
+	r, err := decodeCharset(&contextReader{ctx: ctx, r: r}, opts.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON和CSV文件可能在Windows上保存为CRLF换行，统一为LF；XML解码器会自行处理
+	switch format {
+	case FormatAcfun, FormatBilibiliJSON, FormatIR, FormatCSV:
+		r = &newlineReader{r: r}
 	}
+
+	for _, f := range opts.KeepSlashN {
+		if f == format {
+			opts.literalSlash = true
+		}
+	}
+
+	comments, err := parse(r, opts)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		// 附带文件名和检测到的格式，便于定位问题
+		return nil, fmt.Errorf("%s: %w (detected format %s; the file may be truncated or corrupted)", name, err, format)
+	}
+
+	// 按格式统一尺寸
+	if scale, ok := opts.FormatScale[format]; ok && scale > 0 && scale != 1 {
+		ScaleSize(comments, scale)
+	}
+
+	opts.Stats.addParsed(format, len(comments))
+	return comments, nil
+}
+
+// contextReader 在每次读取前检查ctx的读取器
+// 用于在解码大文件的过程中及时响应取消
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
-// calculateLength 计算文本宽度的辅助函数
-// 目前使用简化版本：按字符数计算
-// TODO: 实现更准确的文本宽度计算，考虑：
-// 1. 不同字符的实际宽度（中文、英文、符号等）
-// 2. 字体特性（比如等宽字体vs比例字体）
-// 3. 字体大小的影响
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// newlineReader 将\r\n和单独的\r转换为\n的读取器
+type newlineReader struct {
+	r  io.Reader
+	cr bool // 上一次读取以\r结尾，紧随其后的\n应丢弃
+}
+
+func (nr *newlineReader) Read(p []byte) (int, error) {
+	n, err := nr.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:n] {
+		if nr.cr && b == '\n' {
+			nr.cr = false
+			continue
+		}
+		nr.cr = b == '\r'
+		if nr.cr {
+			b = '\n'
+		}
+		out = append(out, b)
+	}
+	return len(out), err
+}
+
+// normalizeText 处理弹幕的原始文本
+// 将"/n"、\r\n和单独的\r转换为换行符，并在开启Trim选项时去除首尾空白
+// "/n"是B站等平台表示换行的约定，但也可能是弹幕中真正的字符（如网址路径），
+// 无法从文本本身区分，因此对Options.KeepSlashN中的格式不做转换
+// 各格式的解析函数应在计算文本尺寸之前调用，保证尺寸与最终文本一致
+//
+// 参数：
+//   - content: 弹幕原始文本
+//   - opts: 解析选项
+//
+// 返回值：
+//   - string: 处理后的文本
+func normalizeText(content string, opts Options) string {
+	// JSON字符串中转义的\r\n在解码后仍是CRLF，统一为LF
+	text := content
+	if strings.Contains(text, "\r") {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	if !opts.literalSlash {
+		text = strings.Replace(text, "/n", "\n", -1)
+	}
+	if opts.Trim {
+		text = strings.TrimSpace(text)
+	}
+	return text
+}
+
+// lineBreaks 拆分文本行时识别的换行：弹幕文本中的换行符和ASS的强制换行符
+var lineBreaks = strings.NewReplacer(`\N`, "\n")
+
+// EstimateTextSize 估算文本以fontSize渲染后的宽度和高度（像素）
+// 文本按换行符和ASS的\N拆分为多行，宽度为最宽一行的宽度，高度为行数乘以字号。
+// 不知道实际使用的字体，因此只是估算，用于换行和防止弹幕重叠
+//
+// 参数：
+//   - text: 弹幕文本
+//   - fontSize: 字号（像素）
+//
+// 返回值：
+//   - w: 预估宽度
+//   - h: 预估高度
+func EstimateTextSize(text string, fontSize float64) (w, h float64) {
+	lines := strings.Split(lineBreaks.Replace(text), "\n")
+	for _, line := range lines {
+		w = math.Max(w, calculateLength(line))
+	}
+	return w * fontSize, float64(len(lines)) * fontSize
+}
+
+// calculateLength 计算单行文本的宽度，以字号（全角字符的宽度）为单位
+// 中日韩文字等全角字符计为1，拉丁字母等半角字符计为0.5，组合附加符号和零宽字符不计宽度；
+// 没有考虑字体的实际字形宽度
 //
 // 参数：
 //   - text: 要计算宽度的文本
@@ -112,6 +515,26 @@ func ParseComments(file *os.File, format Format, fontSize float64) ([]Comment, e
 // 返回值：
 //   - float64: 文本的预估宽度
 func calculateLength(text string) float64 {
-	// TODO: 实现更准确的文本宽度计算
-	return float64(len([]rune(text)))
+	var length float64
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc):
+			// 不占宽度
+		case isWide(r):
+			length++
+		default:
+			length += 0.5
+		}
+	}
+	return length
+}
+
+// isWide 判断字符是否为全角字符（东亚宽字符、全角字符及emoji等）
+func isWide(r rune) bool {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// parseFixture 检测并解析test目录下的弹幕文件
+func parseFixture(t *testing.T, name string, opts Options) []Comment {
+	t.Helper()
+	file, err := os.Open("../test/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	format, err := ProbeFormat(file)
+	if err != nil {
+		t.Fatalf("ProbeFormat(%s): %v", name, err)
+	}
+	comments, err := ParseCommentsOptions(file, format, opts)
+	if err != nil {
+		t.Fatalf("ParseCommentsOptions(%s): %v", name, err)
+	}
+	return comments
+}
+
+// texts 返回弹幕的文本列表
+func texts(comments []Comment) []string {
+	var s []string
+	for _, c := range comments {
+		s = append(s, c.Text)
+	}
+	return s
+}
+
+func TestProbeFormatErrors(t *testing.T) {
+	if _, _, err := ProbeFormatReader(strings.NewReader("")); !errors.Is(err, ErrEmptyInput) {
+		t.Errorf("empty input: err = %v, want ErrEmptyInput", err)
+	}
+
+	_, _, err := ProbeFormatReader(strings.NewReader("\x00\x01 not danmaku"))
+	if !errors.Is(err, ErrUnknownFormat) || errors.Is(err, ErrEmptyInput) {
+		t.Errorf("unknown input: err = %v, want ErrUnknownFormat", err)
+	}
+	if !strings.Contains(err.Error(), "00 01") {
+		t.Errorf("error %q does not contain the first bytes", err)
+	}
+}
+
+func TestProbeFormatReader(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		format Format
+	}{
+		{`<?xml version="1.0"?><i><d p="1,1,25,16777215,0,0,u,1">弹幕</d></i>`, FormatBilibili},
+		{`<packet><chat vpos="100">コメント</chat></packet>`, FormatNiconico},
+		{`[{"time": 1, "mode": 1, "size": 25, "color": 16777215, "content": "弹幕"}]`, FormatAcfun},
+	} {
+		format, r, err := ProbeFormatReader(strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != tc.format {
+			t.Errorf("%.20s: format = %v, want %v", tc.input, format, tc.format)
+		}
+		// 返回的读取器仍包含探测时读取的内容
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tc.input {
+			t.Errorf("reader yields %q, want %q", data, tc.input)
+		}
+	}
+}
+
+// syntheticBilibili 生成包含n条弹幕的B站XML
+func syntheticBilibili(n int) string {
+	var b strings.Builder
+	b.WriteString("<i>\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "<d p=\"%d,1,25,16777215,1600000000,0,abcdef,%d\">弹幕%d</d>\n", i, i, i)
+	}
+	b.WriteString("</i>\n")
+	return b.String()
+}
+
+// cancelingReader 读取超过limit字节后调用cancel
+type cancelingReader struct {
+	r      io.Reader
+	read   int
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (cr *cancelingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.read += n
+	if cr.read > cr.limit {
+		cr.cancel()
+	}
+	return n, err
+}
+
+func TestParseCancel(t *testing.T) {
+	data := syntheticBilibili(100000)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 读取约64KB后取消，解析应在读完整个文件之前停止
+	source := &cancelingReader{r: strings.NewReader(data), limit: 64 << 10, cancel: cancel}
+	_, err := parseBilibili(&contextReader{ctx: ctx, r: source}, DefaultOptions(25))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if source.read >= len(data) {
+		t.Errorf("read all %d bytes before stopping", source.read)
+	}
+}
+
+func TestParseCommentsContextCanceled(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "*.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(syntheticBilibili(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseCommentsContext(ctx, file, FormatBilibili, DefaultOptions(25)); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestProbeFormatLongProlog(t *testing.T) {
+	data, err := os.ReadFile("../test/bilibili_prolog.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := strings.Index(string(data), "<i>"); i < 100 {
+		t.Fatalf("<i> at byte %d, fixture must push it past byte 100", i)
+	}
+	if format, _, err := ProbeFormatReader(strings.NewReader(string(data))); err != nil || format != FormatBilibili {
+		t.Errorf("format = %v, %v, want %v", format, err, FormatBilibili)
+	}
+
+	comments := parseFixture(t, "bilibili_prolog.xml", DefaultOptions(25))
+	if got := texts(comments); len(got) != 1 || got[0] != "序言之后的弹幕" {
+		t.Errorf("texts = %q, want [序言之后的弹幕]", got)
+	}
+}
+
+func TestEstimateTextSize(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		w, h float64
+	}{
+		{"", 0, 20},
+		{"弹幕", 40, 20},
+		{"abcd", 40, 20},
+		{"弹幕ab", 60, 20},
+		{"e\u0301\u200b", 10, 20}, // 组合附加符号和零宽字符不计宽度
+		{"一行\n较长的一行", 100, 40},
+		{`第一行\N二\N三`, 60, 60},
+		{"ab\n", 20, 40},
+	} {
+		if w, h := EstimateTextSize(tc.text, 20); w != tc.w || h != tc.h {
+			t.Errorf("EstimateTextSize(%q, 20) = %v, %v, want %v, %v", tc.text, w, h, tc.w, tc.h)
+		}
+	}
+}
+
+func TestParseCommentsReader(t *testing.T) {
+	input := `<i><d p="1,1,25,16777215,0,0,u,1">第一条</d><d p="2,5,25,16777215,0,0,u,2">第二条</d></i>`
+	format, r, err := ProbeFormatReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments, err := ParseCommentsReader(context.Background(), r, "stdin", format, DefaultOptions(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(comments); len(got) != 2 || got[0] != "第一条" || got[1] != "第二条" {
+		t.Errorf("texts = %q, want [第一条 第二条]", got)
+	}
+
+	// 错误信息使用调用方给出的名称
+	_, err = ParseCommentsReader(context.Background(), strings.NewReader(`<i><d p="1,1`), "stdin", FormatBilibili, DefaultOptions(25))
+	if err == nil || !strings.HasPrefix(err.Error(), "stdin: ") {
+		t.Errorf("err = %v, want it to start with the name", err)
+	}
+}
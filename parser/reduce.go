@@ -0,0 +1,47 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// ReduceDensity 在弹幕密集处按比例随机丢弃弹幕
+// 以每条弹幕出现时间之前window秒内的弹幕数作为局部密度，
+// 局部密度超过threshold时以ratio的概率丢弃该弹幕，稀疏处的弹幕全部保留
+// 使用相同种子的rng可以得到确定的结果
+//
+// 参数：
+//   - comments: 要处理的弹幕列表，会按时间线重新排序
+//   - ratio: 密集处丢弃弹幕的概率(0-1)
+//   - window: 计算局部密度的时间窗口（秒）
+//   - threshold: 时间窗口内允许的弹幕数量
+//   - rng: 随机数生成器
+//
+// 返回值：
+//   - []Comment: 处理后的弹幕列表
+func ReduceDensity(comments []Comment, ratio, window float64, threshold int, rng *rand.Rand) []Comment {
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].Timeline < comments[j].Timeline
+	})
+
+	// 先统计每条弹幕的局部密度，保证结果不受丢弃顺序影响
+	density := make([]int, len(comments))
+	begin := 0
+	for i, c := range comments {
+		for comments[begin].Timeline < c.Timeline-window {
+			begin++
+		}
+		density[i] = i - begin + 1
+	}
+
+	reduced := comments[:0]
+	for i, c := range comments {
+		if density[i] > threshold && rng.Float64() < ratio {
+			continue
+		}
+		reduced = append(reduced, c)
+	}
+
+	return reduced
+}
@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// burst 返回一秒内均匀分布的n条弹幕，之后是稀疏的sparse条弹幕
+func burst(n, sparse int) []Comment {
+	var comments []Comment
+	for i := 0; i < n; i++ {
+		comments = append(comments, Comment{Timeline: float64(i) / float64(n), No: i})
+	}
+	for i := 0; i < sparse; i++ {
+		comments = append(comments, Comment{Timeline: float64(10 + 5*i), No: n + i})
+	}
+	return comments
+}
+
+func TestReduceDensity(t *testing.T) {
+	reduced := ReduceDensity(burst(100, 5), 0.5, 1, 10, rand.New(rand.NewSource(42)))
+	if len(reduced) != 61 {
+		t.Errorf("%d comments survived, want 61", len(reduced))
+	}
+
+	// 稀疏处的弹幕全部保留
+	if last := reduced[len(reduced)-5:]; last[0].Timeline != 10 || last[4].Timeline != 30 {
+		t.Errorf("sparse comments were dropped: %+v", last)
+	}
+
+	again := ReduceDensity(burst(100, 5), 0.5, 1, 10, rand.New(rand.NewSource(42)))
+	for i := range reduced {
+		if reduced[i].No != again[i].No {
+			t.Fatalf("same seed gave different results at %d", i)
+		}
+	}
+}
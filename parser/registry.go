@@ -0,0 +1,67 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"io"
+	"sync"
+)
+
+// customParser 通过RegisterParser注册的弹幕格式
+type customParser struct {
+	format Format
+	probe  func([]byte) bool
+	parse  func(io.Reader, float64) ([]Comment, error)
+}
+
+// 已注册的自定义格式，按注册顺序检测
+var (
+	customMu      sync.RWMutex
+	customParsers []customParser
+)
+
+// RegisterParser 注册自定义的弹幕格式，使库的使用者无需修改本包即可支持新的平台
+// 注册后ProbeFormat会先按注册顺序调用各格式的probe，再检测内置格式；
+// ParseComments遇到该格式时调用parse。通常在init函数中调用
+// 格式名与内置格式或已注册的格式重复，或probe、parse为nil时会panic
+//
+// 参数：
+//   - format: 格式名称
+//   - probe: 根据文件开头的字节（可能包含BOM）判断是否为该格式
+//   - parse: 解析弹幕，第二个参数为基准字体大小(Options.FontSize)
+func RegisterParser(format Format, probe func([]byte) bool, parse func(io.Reader, float64) ([]Comment, error)) {
+	if probe == nil || parse == nil {
+		panic("parser: RegisterParser probe or parse is nil")
+	}
+
+	// 检查重复和追加在同一次加锁中完成，并发注册同一格式时只有一次成功
+	customMu.Lock()
+	defer customMu.Unlock()
+	if _, ok := lookupFormatLocked(string(format)); ok {
+		panic("parser: RegisterParser called with duplicate format " + string(format))
+	}
+	customParsers = append(customParsers, customParser{format: format, probe: probe, parse: parse})
+}
+
+// probeCustom 依次调用已注册格式的probe，返回第一个匹配的格式
+func probeCustom(buf []byte) (Format, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	for _, p := range customParsers {
+		if p.probe(buf) {
+			return p.format, true
+		}
+	}
+	return "", false
+}
+
+// findCustom 查找已注册的格式（格式名区分大小写）
+func findCustom(format Format) (customParser, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	for _, p := range customParsers {
+		if p.format == format {
+			return p, true
+		}
+	}
+	return customParser{}, false
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegisterParserConcurrent(t *testing.T) {
+	customMu.Lock()
+	saved := customParsers
+	customMu.Unlock()
+	t.Cleanup(func() {
+		customMu.Lock()
+		customParsers = saved
+		customMu.Unlock()
+	})
+
+	probe := func([]byte) bool { return false }
+	parse := func(io.Reader, float64) ([]Comment, error) { return nil, nil }
+
+	// 并发注册同一格式，只有一次成功，其余都因重复而panic
+	var registered, duplicates atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if recover() != nil {
+					duplicates.Add(1)
+				}
+			}()
+			RegisterParser("test-concurrent", probe, parse)
+			registered.Add(1)
+		}()
+	}
+	wg.Wait()
+
+	if registered.Load() != 1 || duplicates.Load() != 15 {
+		t.Errorf("%d registrations succeeded and %d panicked, want 1 and 15", registered.Load(), duplicates.Load())
+	}
+	n := 0
+	for _, f := range Formats() {
+		if f == "test-concurrent" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("format listed %d times, want once", n)
+	}
+
+	// 与内置格式重名（不区分大小写）时同样panic
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a built-in format name did not panic")
+		}
+	}()
+	RegisterParser("bilibili", probe, parse)
+}
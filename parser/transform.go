@@ -0,0 +1,139 @@
+// Package parser 实现弹幕解析功能
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// emotePattern 匹配B站表情占位符，如[doge]、[笑哭]
+var emotePattern = regexp.MustCompile(`\[[^\[\]\n]+\]`)
+
+// ShiftTimeline 将所有弹幕的时间线整体平移
+// 直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要平移的弹幕列表
+//   - delta: 平移量（秒），负数表示提前
+func ShiftTimeline(comments []Comment, delta float64) {
+	for i := range comments {
+		comments[i].Timeline += delta
+	}
+}
+
+// ScaleTimeline 按播放倍速缩放所有弹幕的时间线
+// 倍速为2时时间线减半，倍速为0.5时时间线加倍，直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要缩放的弹幕列表
+//   - speed: 播放倍速，必须为正数
+func ScaleTimeline(comments []Comment, speed float64) {
+	for i := range comments {
+		comments[i].Timeline /= speed
+	}
+}
+
+// ScaleSize 按比例缩放所有弹幕的字体大小和预估尺寸
+// 用于将按参考分辨率计算的尺寸换算到输出分辨率，直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要缩放的弹幕列表
+//   - factor: 缩放比例，必须为正数
+func ScaleSize(comments []Comment, factor float64) {
+	for i := range comments {
+		comments[i].Size *= factor
+		comments[i].Width *= factor
+		comments[i].Height *= factor
+	}
+}
+
+// NormalizeNFC 将弹幕文本转换为Unicode NFC规范形式并重新计算预估尺寸
+// 组合字符（如"e\u0301"）合并为预组合字符（如"é"），使写法不同的相同文本能被去重识别，宽度估算也更准确
+// 直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要处理的弹幕列表
+func NormalizeNFC(comments []Comment) {
+	for i := range comments {
+		c := &comments[i]
+		if norm.NFC.IsNormalString(c.Text) {
+			continue
+		}
+		c.Text = norm.NFC.String(c.Text)
+		c.Width, c.Height = EstimateTextSize(c.Text, c.Size)
+	}
+}
+
+// StripEmotes 移除弹幕文本中的表情占位符（如[doge]）并重新计算预估尺寸
+// 移除后文本可能为空，可配合NotBlank过滤，直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要处理的弹幕列表
+func StripEmotes(comments []Comment) {
+	for i := range comments {
+		c := &comments[i]
+		text := emotePattern.ReplaceAllString(c.Text, "")
+		if text == c.Text {
+			continue
+		}
+		c.Text = text
+		c.Width, c.Height = EstimateTextSize(text, c.Size)
+	}
+}
+
+// TruncateText 将字符数（按rune计算）超过max的弹幕截断为前max-1个字符并加上省略号，然后重新计算预估尺寸
+// 截断后连同省略号恰好为max个字符；直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要处理的弹幕列表
+//   - max: 保留的最大字符数，必须为正数
+func TruncateText(comments []Comment, max int) {
+	for i := range comments {
+		c := &comments[i]
+		runes := []rune(c.Text)
+		if len(runes) <= max {
+			continue
+		}
+		c.Text = string(runes[:max-1]) + "…"
+		c.Width, c.Height = EstimateTextSize(c.Text, c.Size)
+	}
+}
+
+// WrapText 在固定弹幕的预估宽度超过maxWidth时按预估宽度插入换行并重新计算预估尺寸
+// 滚动弹幕不受影响；直接修改传入的弹幕列表
+//
+// 参数：
+//   - comments: 要处理的弹幕列表
+//   - maxWidth: 每行的最大宽度（像素），必须为正数
+func WrapText(comments []Comment, maxWidth float64) {
+	for i := range comments {
+		c := &comments[i]
+		if (c.Position != 1 && c.Position != 2) || c.Width <= maxWidth || c.Size <= 0 {
+			continue
+		}
+
+		// 按字号换算每行可容纳的宽度（以字号为单位），逐字累计预估宽度，超出时换行，每行至少一个字
+		perLine := maxWidth / c.Size
+
+		var lines []string
+		for _, line := range strings.Split(c.Text, "\n") {
+			var current []rune
+			length := 0.0
+			for _, r := range line {
+				w := calculateLength(string(r))
+				if len(current) > 0 && length+w > perLine {
+					lines = append(lines, string(current))
+					current, length = nil, 0
+				}
+				current = append(current, r)
+				length += w
+			}
+			lines = append(lines, string(current))
+		}
+
+		c.Text = strings.Join(lines, "\n")
+		c.Width, c.Height = EstimateTextSize(c.Text, c.Size)
+	}
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScaleTimeline(t *testing.T) {
+	comments := []Comment{{Timeline: 1}, {Timeline: 3}, {Timeline: 3}, {Timeline: 10}}
+	ScaleTimeline(comments, 2)
+
+	want := []float64{0.5, 1.5, 1.5, 5}
+	for i, c := range comments {
+		if c.Timeline != want[i] {
+			t.Errorf("comments[%d].Timeline = %v, want %v", i, c.Timeline, want[i])
+		}
+		if i > 0 && c.Timeline < comments[i-1].Timeline {
+			t.Errorf("comments[%d] is out of order", i)
+		}
+	}
+
+	ScaleTimeline(comments, 0.5)
+	if comments[3].Timeline != 10 {
+		t.Errorf("slowing down gave %v, want 10", comments[3].Timeline)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	long := strings.Repeat("字", 50)
+	comments := []Comment{
+		{Text: long, Position: 1, Size: 40},
+		{Text: long, Position: 0, Size: 40},
+	}
+	for i := range comments {
+		comments[i].Width, comments[i].Height = EstimateTextSize(comments[i].Text, 40)
+	}
+	WrapText(comments, 800)
+
+	// 每行20个全角字符（800/40），50个字分为3行
+	c := comments[0]
+	lines := strings.Split(c.Text, "\n")
+	if len(lines) != 3 || len([]rune(lines[0])) != 20 || len([]rune(lines[2])) != 10 {
+		t.Errorf("wrapped text = %q", c.Text)
+	}
+	if c.Width != 800 || c.Height != 120 {
+		t.Errorf("wrapped size = %vx%v, want 800x120", c.Width, c.Height)
+	}
+
+	// 滚动弹幕不换行
+	if c := comments[1]; c.Text != long || c.Width != 2000 {
+		t.Errorf("scrolling comment changed: %q, width %v", c.Text, c.Width)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	comments := []Comment{{Text: "一二三四五", Size: 20}, {Text: "一二三四五六", Size: 20}, {Text: "abc", Size: 20}}
+	TruncateText(comments, 5)
+
+	// 恰好5个字符的弹幕不变，超过时保留4个字符加省略号，共5个字符
+	want := []string{"一二三四五", "一二三四…", "abc"}
+	for i, c := range comments {
+		if c.Text != want[i] {
+			t.Errorf("comments[%d] = %q, want %q", i, c.Text, want[i])
+		}
+	}
+	if w, _ := EstimateTextSize("一二三四…", 20); comments[1].Width != w {
+		t.Errorf("width = %v, want %v", comments[1].Width, w)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+// validateInputs 使用所有解析器分别解析每个输入文件，向标准错误输出各解析器的结果
+// 用于排查ProbeFormat误判的文件：表格中列出检测到的格式，以及每种格式能否解析、解析出多少条弹幕。
+// 压缩文件不会解压。没有任何解析器能解析某个输入时返回false
+func validateInputs(ctx context.Context, cfg *Config, opts parser.Options) bool {
+	ok := true
+	for _, input := range cfg.InputFiles {
+		file, cleanup, err := openInput(input, cfg.Timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", input, err)
+			ok = false
+			continue
+		}
+		succeeded, err := validateFile(ctx, os.Stderr, input, file, opts)
+		cleanup()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return false
+		}
+		if succeeded == 0 {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// validateFile 依次使用每种格式的解析器解析file并输出结果表格
+// 返回解析成功的格式数，只有ctx被取消时才返回错误
+func validateFile(ctx context.Context, w io.Writer, name string, file inputFile, opts parser.Options) (int, error) {
+	probed, _, err := parser.ProbeFormatReader(file)
+	if err != nil {
+		fmt.Fprintf(w, "%s (probe: %v):\n", name, err)
+	} else {
+		fmt.Fprintf(w, "%s (probe: %s):\n", name, probed)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	succeeded := 0
+	for _, format := range parser.Formats() {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return succeeded, err
+		}
+
+		comments, err := parser.ParseCommentsReader(ctx, file, name, format, opts)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return succeeded, ctxErr
+		}
+		if err != nil {
+			// 表格中已有文件名和格式，只输出解析器本身的错误
+			if inner := errors.Unwrap(err); inner != nil {
+				err = inner
+			}
+			fmt.Fprintf(tw, "  %s\tfailed\t%v\n", format, err)
+			continue
+		}
+		succeeded++
+		fmt.Fprintf(tw, "  %s\tok\t%d comments\n", format, len(comments))
+	}
+	return succeeded, tw.Flush()
+}
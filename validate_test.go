@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/m13253/danmaku2ass/parser"
+)
+
+func TestValidateFile(t *testing.T) {
+	file, err := os.Open("test/niconico_sizes.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var b strings.Builder
+	succeeded, err := validateFile(context.Background(), &b, "niconico_sizes.xml", file, parser.DefaultOptions(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+	if succeeded != 1 {
+		t.Errorf("%d parsers succeeded, want only Niconico:\n%s", succeeded, report)
+	}
+	if !strings.HasPrefix(report, "niconico_sizes.xml (probe: Niconico):\n") {
+		t.Errorf("report does not start with the probed format:\n%s", report)
+	}
+	for _, pattern := range []string{
+		`(?m)^  Niconico +ok +3 comments$`,
+		`(?m)^  Bilibili +failed +.*<i>`,
+		`(?m)^  Acfun +failed `,
+		`(?m)^  BilibiliJSON +failed `,
+		`(?m)^  IR +failed `,
+		`(?m)^  CSV +failed `,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(report) {
+			t.Errorf("report does not match %s:\n%s", pattern, report)
+		}
+	}
+}